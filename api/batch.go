@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/service"
+	"io"
+	"os"
+)
+
+const batchUsage = `Использование:
+  server batch create -catalog ID -campaign ID -size N [-note текст] [-out файл.csv]
+  server batch export -id ID [-out файл.csv]
+  server batch void -id ID`
+
+// runBatchCommand - CLI для партий печатных кодов, те же операции, что и /admin/batches
+func runBatchCommand(ctx context.Context, s *service.Service, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("не указана команда\n%s", batchUsage)
+	}
+
+	fs := flag.NewFlagSet("batch "+args[0], flag.ContinueOnError)
+	var (
+		id         = fs.Int64("id", 0, "id партии")
+		catalogID  = fs.Int64("catalog", 0, "id приза в каталоге")
+		campaignID = fs.Int64("campaign", 0, "id акции")
+		size       = fs.Int("size", 0, "количество кодов")
+		note       = fs.String("note", "", "комментарий к партии")
+		out        = fs.String("out", "", "файл для CSV (по умолчанию stdout)")
+	)
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		batch, err := s.CreateBatch(ctx, *catalogID, *campaignID, *size, *note)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Создана партия %d: %d кодов\n", batch.ID, batch.Size)
+		return exportBatch(ctx, s, batch.ID, *out)
+
+	case "export":
+		return exportBatch(ctx, s, *id, *out)
+
+	case "void":
+		voided, err := s.VoidBatch(ctx, *id)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Партия %d аннулирована, кодов: %d\n", *id, voided)
+		return nil
+	}
+
+	return fmt.Errorf("неизвестная команда %q\n%s", args[0], batchUsage)
+}
+
+func exportBatch(ctx context.Context, s *service.Service, batchID int64, out string) error {
+	var w io.Writer = os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", out, err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	return s.ExportBatchCSV(ctx, batchID, w)
+}
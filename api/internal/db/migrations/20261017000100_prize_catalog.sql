@@ -0,0 +1,30 @@
+-- +goose Up
+
+-- Каталог призов колеса: сервер сам разыгрывает приз по весам
+CREATE TABLE IF NOT EXISTS prize_catalog (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    weight INTEGER NOT NULL DEFAULT 1 CHECK (weight >= 0),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Переносим в каталог призы, которые раньше присылал фронтенд
+INSERT INTO prize_catalog (name)
+SELECT DISTINCT prize FROM prizes
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE prizes ADD COLUMN IF NOT EXISTS catalog_id INTEGER REFERENCES prize_catalog(id);
+
+UPDATE prizes p
+SET catalog_id = c.id
+FROM prize_catalog c
+WHERE c.name = p.prize AND p.catalog_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_prizes_catalog_id ON prizes(catalog_id);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_prizes_catalog_id;
+ALTER TABLE prizes DROP COLUMN IF EXISTS catalog_id;
+DROP TABLE IF EXISTS prize_catalog;
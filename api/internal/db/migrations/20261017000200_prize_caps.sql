@@ -0,0 +1,26 @@
+-- +goose Up
+
+-- Лимиты выдачи: общий на весь тираж и необязательный дневной (NULL - без ограничения)
+ALTER TABLE prize_catalog
+    ADD COLUMN IF NOT EXISTS total_cap INTEGER CHECK (total_cap >= 0),
+    ADD COLUMN IF NOT EXISTS daily_cap INTEGER CHECK (daily_cap >= 0),
+    ADD COLUMN IF NOT EXISTS issued_total INTEGER NOT NULL DEFAULT 0;
+
+UPDATE prize_catalog c
+SET issued_total = (SELECT COUNT(*) FROM prizes p WHERE p.catalog_id = c.id);
+
+-- Счетчик выданных кодов по дням
+CREATE TABLE IF NOT EXISTS prize_daily_issues (
+    catalog_id INTEGER NOT NULL REFERENCES prize_catalog(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    issued INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (catalog_id, day)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS prize_daily_issues;
+ALTER TABLE prize_catalog
+    DROP COLUMN IF EXISTS issued_total,
+    DROP COLUMN IF EXISTS daily_cap,
+    DROP COLUMN IF EXISTS total_cap;
@@ -0,0 +1,38 @@
+-- +goose Up
+
+-- Акции: окно выдачи кодов, окно погашения и адрес для получения приза
+CREATE TABLE IF NOT EXISTS campaigns (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    issue_starts_at TIMESTAMP NOT NULL,
+    issue_ends_at TIMESTAMP NOT NULL,
+    redeem_starts_at TIMESTAMP NOT NULL,
+    redeem_ends_at TIMESTAMP NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (issue_starts_at < issue_ends_at),
+    CHECK (redeem_starts_at < redeem_ends_at)
+);
+
+-- Текущая акция, которая раньше была зашита в текст сообщения бота
+INSERT INTO campaigns (name, issue_starts_at, issue_ends_at, redeem_starts_at, redeem_ends_at, address)
+VALUES (
+    'Новогоднее колесо',
+    '2025-11-17 00:00', '2026-01-01 00:00',
+    '2026-01-01 00:00', '2026-02-01 00:00',
+    E'ТЦ Ладья, улица Дубравная 34/29\nКафе-Пекарня Миндальное Настроение'
+);
+
+ALTER TABLE prizes ADD COLUMN IF NOT EXISTS campaign_id INTEGER REFERENCES campaigns(id);
+
+UPDATE prizes SET campaign_id = (SELECT MIN(id) FROM campaigns) WHERE campaign_id IS NULL;
+
+ALTER TABLE prizes ALTER COLUMN campaign_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_prizes_campaign_id ON prizes(campaign_id);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_prizes_campaign_id;
+ALTER TABLE prizes DROP COLUMN IF EXISTS campaign_id;
+DROP TABLE IF EXISTS campaigns;
@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- Использованные токены вращения колеса; храним до истечения срока, чтобы не дать повторить запрос
+CREATE TABLE IF NOT EXISTS spent_spin_tokens (
+    token_id TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    spent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_spent_spin_tokens_expires_at ON spent_spin_tokens(expires_at);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_spent_spin_tokens_expires_at;
+DROP TABLE IF EXISTS spent_spin_tokens;
@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Ключи идемпотентности POST /prize: повтор запроса с тем же ключом возвращает уже выданный код
+CREATE TABLE IF NOT EXISTS prize_idempotency_keys (
+    session_id TEXT NOT NULL,
+    key TEXT NOT NULL,
+    prize_id INTEGER REFERENCES prizes(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_prize_idempotency_keys_created_at ON prize_idempotency_keys(created_at);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_prize_idempotency_keys_created_at;
+DROP TABLE IF EXISTS prize_idempotency_keys;
@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- Счетчики лимитов по фиксированным окнам: по IP и по cookie клиента.
+-- Живут в базе, чтобы переживать рестарты и работать на нескольких репликах API
+CREATE TABLE IF NOT EXISTS rate_limits (
+    bucket TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    window_start TIMESTAMP NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limits_window_start ON rate_limits(window_start);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_rate_limits_window_start;
+DROP TABLE IF EXISTS rate_limits;
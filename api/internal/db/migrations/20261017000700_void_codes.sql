@@ -0,0 +1,11 @@
+-- +goose Up
+
+-- Аннулированные коды: их нельзя привязать к Телеграму и погасить на кассе
+ALTER TABLE prizes ADD COLUMN IF NOT EXISTS voided_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_prizes_used_at ON prizes(used_at) WHERE used_at IS NOT NULL;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_prizes_used_at;
+ALTER TABLE prizes DROP COLUMN IF EXISTS voided_at;
@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- Срок действия кода: сначала на привязку в Телеграме, после привязки - на погашение.
+-- Просроченные коды фоновая задача аннулирует с причиной 'expired'
+ALTER TABLE prizes
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS void_reason TEXT;
+
+UPDATE prizes SET void_reason = 'manual' WHERE voided_at IS NOT NULL AND void_reason IS NULL;
+
+-- Уже выданным кодам срок - до конца погашения их акции
+UPDATE prizes p
+SET expires_at = c.redeem_ends_at
+FROM campaigns c
+WHERE c.id = p.campaign_id AND p.expires_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_prizes_expires_at ON prizes(expires_at)
+    WHERE used_at IS NULL AND voided_at IS NULL;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_prizes_expires_at;
+ALTER TABLE prizes
+    DROP COLUMN IF EXISTS void_reason,
+    DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- Партии заранее сгенерированных кодов для печати на чеках и листовках
+CREATE TABLE IF NOT EXISTS code_batches (
+    id SERIAL PRIMARY KEY,
+    catalog_id INTEGER NOT NULL REFERENCES prize_catalog(id),
+    campaign_id INTEGER NOT NULL REFERENCES campaigns(id),
+    size INTEGER NOT NULL CHECK (size > 0),
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    voided_at TIMESTAMP
+);
+
+ALTER TABLE prizes ADD COLUMN IF NOT EXISTS batch_id INTEGER REFERENCES code_batches(id);
+
+CREATE INDEX IF NOT EXISTS idx_prizes_batch_id ON prizes(batch_id) WHERE batch_id IS NOT NULL;
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_prizes_batch_id;
+ALTER TABLE prizes DROP COLUMN IF EXISTS batch_id;
+DROP TABLE IF EXISTS code_batches;
@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- Журнал попыток погашения кодов: кто из кассиров, в каком чате и с каким результатом
+CREATE TABLE IF NOT EXISTS redemptions (
+    id SERIAL PRIMARY KEY,
+    prize_id INTEGER REFERENCES prizes(id),
+    code TEXT NOT NULL,
+    actor_telegram_id BIGINT NOT NULL,
+    actor_username TEXT,
+    chat_id BIGINT NOT NULL,
+    message_id INTEGER,
+    result TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_redemptions_code ON redemptions(code, created_at);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_redemptions_code;
+DROP TABLE IF EXISTS redemptions;
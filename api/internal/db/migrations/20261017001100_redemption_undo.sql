@@ -0,0 +1,8 @@
+-- +goose Up
+
+-- Причина отмены активации менеджером (для остальных записей журнала пусто)
+ALTER TABLE redemptions ADD COLUMN IF NOT EXISTS reason TEXT;
+
+-- +goose Down
+
+ALTER TABLE redemptions DROP COLUMN IF EXISTS reason;
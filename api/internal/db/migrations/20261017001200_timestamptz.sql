@@ -0,0 +1,89 @@
+-- +goose Up
+
+-- Все отметки времени храним как timestamptz в UTC. До этого колонки были "наивными":
+-- большинство значений записывалось по UTC, а used_at, журнал погашений и окна акций - по Москве
+
+-- Срок кода, совпадающий с концом окна акции, был скопирован из него, то есть тоже по Москве
+UPDATE prizes p
+SET expires_at = p.expires_at - INTERVAL '3 hours'
+FROM campaigns c
+WHERE c.id = p.campaign_id AND p.expires_at = c.redeem_ends_at;
+
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+
+ALTER TABLE prizes
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN used_at TYPE TIMESTAMPTZ USING used_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN voided_at TYPE TIMESTAMPTZ USING voided_at AT TIME ZONE 'UTC',
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ USING expires_at AT TIME ZONE 'UTC';
+
+ALTER TABLE campaigns
+    ALTER COLUMN issue_starts_at TYPE TIMESTAMPTZ USING issue_starts_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN issue_ends_at TYPE TIMESTAMPTZ USING issue_ends_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN redeem_starts_at TYPE TIMESTAMPTZ USING redeem_starts_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN redeem_ends_at TYPE TIMESTAMPTZ USING redeem_ends_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+
+ALTER TABLE prize_catalog
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+
+ALTER TABLE spent_spin_tokens
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ USING expires_at AT TIME ZONE 'UTC',
+    ALTER COLUMN spent_at TYPE TIMESTAMPTZ USING spent_at AT TIME ZONE 'UTC';
+
+ALTER TABLE prize_idempotency_keys
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC';
+
+ALTER TABLE rate_limits
+    ALTER COLUMN window_start TYPE TIMESTAMPTZ USING window_start AT TIME ZONE 'UTC';
+
+ALTER TABLE code_batches
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN voided_at TYPE TIMESTAMPTZ USING voided_at AT TIME ZONE 'UTC';
+
+ALTER TABLE redemptions
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ USING created_at AT TIME ZONE 'Europe/Moscow';
+
+-- +goose Down
+
+ALTER TABLE redemptions
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'Europe/Moscow';
+
+ALTER TABLE code_batches
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN voided_at TYPE TIMESTAMP USING voided_at AT TIME ZONE 'UTC';
+
+ALTER TABLE rate_limits
+    ALTER COLUMN window_start TYPE TIMESTAMP USING window_start AT TIME ZONE 'UTC';
+
+ALTER TABLE prize_idempotency_keys
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
+
+ALTER TABLE spent_spin_tokens
+    ALTER COLUMN expires_at TYPE TIMESTAMP USING expires_at AT TIME ZONE 'UTC',
+    ALTER COLUMN spent_at TYPE TIMESTAMP USING spent_at AT TIME ZONE 'UTC';
+
+ALTER TABLE prize_catalog
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
+
+ALTER TABLE campaigns
+    ALTER COLUMN issue_starts_at TYPE TIMESTAMP USING issue_starts_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN issue_ends_at TYPE TIMESTAMP USING issue_ends_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN redeem_starts_at TYPE TIMESTAMP USING redeem_starts_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN redeem_ends_at TYPE TIMESTAMP USING redeem_ends_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
+
+ALTER TABLE prizes
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC',
+    ALTER COLUMN used_at TYPE TIMESTAMP USING used_at AT TIME ZONE 'Europe/Moscow',
+    ALTER COLUMN voided_at TYPE TIMESTAMP USING voided_at AT TIME ZONE 'UTC',
+    ALTER COLUMN expires_at TYPE TIMESTAMP USING expires_at AT TIME ZONE 'UTC';
+
+UPDATE prizes p
+SET expires_at = p.expires_at + INTERVAL '3 hours'
+FROM campaigns c
+WHERE c.id = p.campaign_id AND p.expires_at = c.redeem_ends_at - INTERVAL '3 hours';
+
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMP USING created_at AT TIME ZONE 'UTC';
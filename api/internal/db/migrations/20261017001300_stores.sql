@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- Магазины: адрес и часы работы для сообщений бота, часовой пояс и чат кассиров
+CREATE TABLE IF NOT EXISTS stores (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    hours TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT 'Europe/Moscow',
+    cashier_chat_id BIGINT UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Первая пекарня, адрес которой раньше хранился в акции. Чат кассиров бот привяжет
+-- при запуске из ADMIN_TELEGRAM_CHAT_ID, если ни один магазин еще не привязан
+INSERT INTO stores (name, address)
+VALUES ('Миндальное Настроение', E'ТЦ Ладья, улица Дубравная 34/29\nКафе-Пекарня Миндальное Настроение');
+
+-- Магазины, в которых можно получить приз каталога. Нет строк - приз действует везде
+CREATE TABLE IF NOT EXISTS prize_catalog_stores (
+    catalog_id INTEGER NOT NULL REFERENCES prize_catalog(id) ON DELETE CASCADE,
+    store_id INTEGER NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    PRIMARY KEY (catalog_id, store_id)
+);
+
+-- Магазин, в чате которого была попытка погашения
+ALTER TABLE redemptions ADD COLUMN IF NOT EXISTS store_id INTEGER REFERENCES stores(id);
+
+-- +goose Down
+
+ALTER TABLE redemptions DROP COLUMN IF EXISTS store_id;
+DROP TABLE IF EXISTS prize_catalog_stores;
+DROP TABLE IF EXISTS stores;
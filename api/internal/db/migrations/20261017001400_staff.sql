@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Сотрудники и их роли в боте. Добавленный по @username получает telegram_id,
+-- когда впервые отправит боту /start
+CREATE TABLE IF NOT EXISTS staff (
+    id SERIAL PRIMARY KEY,
+    telegram_id BIGINT UNIQUE,
+    username TEXT UNIQUE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'admin', 'cashier', 'developer')),
+    added_by BIGINT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (telegram_id IS NOT NULL OR username IS NOT NULL)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS staff;
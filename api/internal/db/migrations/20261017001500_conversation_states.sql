@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- Состояние диалогов бота (привязка кода, черновик рассылки, отмена активации).
+-- Ключ - пользователь и чат, чтобы у каждого админа был свой черновик; просроченные записи не читаются
+CREATE TABLE IF NOT EXISTS conversation_states (
+    user_id BIGINT NOT NULL,
+    chat_id BIGINT NOT NULL,
+    step TEXT NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, chat_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_states_expires_at ON conversation_states(expires_at);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_conversation_states_expires_at;
+DROP TABLE IF EXISTS conversation_states;
@@ -0,0 +1,39 @@
+-- +goose Up
+
+-- Рассылки. Бот отправляет их в фоне пачками и после перезапуска продолжает незавершенные
+CREATE TABLE IF NOT EXISTS mailings (
+    id BIGSERIAL PRIMARY KEY,
+    text TEXT NOT NULL DEFAULT '',
+    media_id TEXT,
+    media_type TEXT,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'done')),
+    created_by BIGINT NOT NULL,
+    -- Сообщение в чате админа, в котором бот показывает прогресс
+    progress_chat_id BIGINT NOT NULL,
+    progress_message_id INT,
+    total INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_mailings_unfinished ON mailings(id) WHERE status <> 'done';
+
+-- Получатели рассылки: список фиксируется при создании, статус доставки - по каждому
+CREATE TABLE IF NOT EXISTS mailing_deliveries (
+    mailing_id BIGINT NOT NULL REFERENCES mailings(id) ON DELETE CASCADE,
+    telegram_id BIGINT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    error TEXT,
+    sent_at TIMESTAMPTZ,
+    PRIMARY KEY (mailing_id, telegram_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mailing_deliveries_pending ON mailing_deliveries(mailing_id, telegram_id) WHERE status = 'pending';
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_mailing_deliveries_pending;
+DROP TABLE IF EXISTS mailing_deliveries;
+DROP INDEX IF EXISTS idx_mailings_unfinished;
+DROP TABLE IF EXISTS mailings;
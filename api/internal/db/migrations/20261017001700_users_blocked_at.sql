@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- Когда пользователь заблокировал бота или удалил аккаунт. Таким не шлем рассылки,
+-- пока он снова не напишет боту
+ALTER TABLE users ADD COLUMN IF NOT EXISTS blocked_at TIMESTAMPTZ;
+
+-- +goose Down
+
+ALTER TABLE users DROP COLUMN IF EXISTS blocked_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- Аудитория рассылки: все, с неиспользованным призом, погасившие, без телефона,
+-- зарегистрированные в период, участники акции или получатели приза
+ALTER TABLE mailings ADD COLUMN IF NOT EXISTS segment JSONB NOT NULL DEFAULT '{"kind": "all"}';
+
+-- +goose Down
+
+ALTER TABLE mailings DROP COLUMN IF EXISTS segment;
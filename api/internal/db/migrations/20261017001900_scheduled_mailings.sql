@@ -0,0 +1,24 @@
+-- +goose Up
+
+-- Отложенные рассылки: бот начнет отправку не раньше scheduled_at. Получатели фиксируются
+-- в момент запуска, чтобы учесть пользователей, пришедших после планирования
+ALTER TABLE mailings ADD COLUMN IF NOT EXISTS scheduled_at TIMESTAMPTZ;
+
+ALTER TABLE mailings DROP CONSTRAINT IF EXISTS mailings_status_check;
+ALTER TABLE mailings ADD CONSTRAINT mailings_status_check
+    CHECK (status IN ('pending', 'running', 'done', 'cancelled'));
+
+DROP INDEX IF EXISTS idx_mailings_unfinished;
+CREATE INDEX IF NOT EXISTS idx_mailings_unfinished ON mailings(id) WHERE status IN ('pending', 'running');
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_mailings_unfinished;
+CREATE INDEX IF NOT EXISTS idx_mailings_unfinished ON mailings(id) WHERE status <> 'done';
+
+UPDATE mailings SET status = 'done', finished_at = COALESCE(finished_at, CURRENT_TIMESTAMP) WHERE status = 'cancelled';
+ALTER TABLE mailings DROP CONSTRAINT IF EXISTS mailings_status_check;
+ALTER TABLE mailings ADD CONSTRAINT mailings_status_check
+    CHECK (status IN ('pending', 'running', 'done'));
+
+ALTER TABLE mailings DROP COLUMN IF EXISTS scheduled_at;
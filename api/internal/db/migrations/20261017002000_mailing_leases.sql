@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Аренда рассылки воркером бота: при нескольких репликах рассылку отправляет только владелец
+-- аренды, а после его падения она истекает и рассылку подхватывает другая реплика
+ALTER TABLE mailings
+    ADD COLUMN IF NOT EXISTS locked_by TEXT,
+    ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+
+-- Пачка получателей, взятая в отправку; после падения воркера заявка истекает
+ALTER TABLE mailing_deliveries ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMPTZ;
+
+-- +goose Down
+
+ALTER TABLE mailing_deliveries DROP COLUMN IF EXISTS claimed_until;
+ALTER TABLE mailings
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS locked_by;
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminAuth пропускает запросы с одним из API-ключей в заголовке
+// "Authorization: Bearer <ключ>" или "X-API-Key: <ключ>"
+func AdminAuth(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			key = bearer
+		}
+
+		if key != "" {
+			for _, k := range keys {
+				if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusUnauthorized, "Нужен API-ключ администратора")
+	}
+}
+
+// Ответ со страницей списка
+func pageResponse(items any, total, limit, offset int) gin.H {
+	return gin.H{
+		"items":  items,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	}
+}
+
+func queryInt(c *gin.Context, key string) (int, error) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func queryInt64(c *gin.Context, key string) (*int64, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func queryTime(c *gin.Context, key string) (*time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Разбирает limit и offset; при ошибке отвечает 400
+func parsePage(c *gin.Context) (int, int, bool) {
+	limit, err := queryInt(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный limit")
+		return 0, 0, false
+	}
+	offset, err := queryInt(c, "offset")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный offset")
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+// AdminListPrizes - GET /admin/prizes?status=&campaign_id=&catalog_id=&code=&limit=&offset=
+func (h *Handler) AdminListPrizes(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	f := model.PrizeFilter{
+		Status: c.Query("status"),
+		Code:   c.Query("code"),
+		Limit:  limit,
+		Offset: offset,
+	}
+	switch f.Status {
+	case "", model.PrizeStatusIssued, model.PrizeStatusClaimed, model.PrizeStatusRedeemed,
+		model.PrizeStatusVoided, model.PrizeStatusExpired:
+	default:
+		c.JSON(http.StatusBadRequest, "Некорректный status")
+		return
+	}
+
+	var err error
+	if f.CampaignID, err = queryInt64(c, "campaign_id"); err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный campaign_id")
+		return
+	}
+	if f.CatalogID, err = queryInt64(c, "catalog_id"); err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный catalog_id")
+		return
+	}
+
+	prizes, total, err := h.service.ListPrizes(c, f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.ListPrizes:", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(prizes, total, f.Limit, f.Offset))
+}
+
+// AdminListUsers - GET /admin/users?phone=&limit=&offset=
+func (h *Handler) AdminListUsers(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	f := model.UserFilter{
+		Phone:  c.Query("phone"),
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	users, total, err := h.service.ListUsers(c, f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.ListUsers:", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(users, total, f.Limit, f.Offset))
+}
+
+// AdminListRedemptions - GET /admin/redemptions?from=&to=&campaign_id=&store_id=&result=&limit=&offset=
+// (from/to в RFC 3339, result - activated, undone, expired и другие результаты журнала)
+func (h *Handler) AdminListRedemptions(c *gin.Context) {
+	limit, offset, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	f := model.RedemptionFilter{
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	var err error
+	if f.From, err = queryTime(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный from")
+		return
+	}
+	if f.To, err = queryTime(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный to")
+		return
+	}
+	if f.CampaignID, err = queryInt64(c, "campaign_id"); err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный campaign_id")
+		return
+	}
+	if f.StoreID, err = queryInt64(c, "store_id"); err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный store_id")
+		return
+	}
+	f.Result = c.Query("result")
+
+	redemptions, total, err := h.service.ListRedemptions(c, f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.ListRedemptions:", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(redemptions, total, f.Limit, f.Offset))
+}
+
+type issuePrizeRequest struct {
+	CatalogID  int64  `json:"catalog_id" binding:"required"`
+	CampaignID *int64 `json:"campaign_id"`
+}
+
+// AdminIssuePrize - POST /admin/prizes: ручная выдача кода на приз каталога
+func (h *Handler) AdminIssuePrize(c *gin.Context) {
+	var req issuePrizeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "У вас невалидный запрос")
+		return
+	}
+
+	prize, err := h.service.IssuePrize(c, req.CatalogID, req.CampaignID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrCatalogPrizeNotFound), errors.Is(err, errs.ErrCampaignNotFound):
+			c.JSON(http.StatusNotFound, "Приз или акция не найдены")
+		case errors.Is(err, errs.ErrNoActiveCampaign):
+			c.JSON(http.StatusConflict, "Нет текущей акции, укажите campaign_id")
+		case errors.Is(err, errs.ErrPrizeExhausted):
+			c.JSON(http.StatusConflict, "Лимит этого приза исчерпан")
+		default:
+			c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+			log.Println("error h.service.IssuePrize:", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, prize)
+}
+
+// AdminVoidPrize - POST /admin/prizes/:code/void: аннулирование непогашенного кода
+func (h *Handler) AdminVoidPrize(c *gin.Context) {
+	prize, err := h.service.VoidPrize(c, c.Param("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, errs.ErrPrizeNotFound):
+			c.JSON(http.StatusNotFound, "Код не найден")
+		case errors.Is(err, errs.ErrPrizeRedeemed):
+			c.JSON(http.StatusConflict, "Код уже погашен")
+		case errors.Is(err, errs.ErrPrizeVoided):
+			c.JSON(http.StatusConflict, "Код уже аннулирован")
+		default:
+			c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+			log.Println("error h.service.VoidPrize:", err)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, prize)
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/berduk-dev/bad-da-yo/internal/service"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+type createBatchRequest struct {
+	CatalogID  int64  `json:"catalog_id" binding:"required"`
+	CampaignID int64  `json:"campaign_id" binding:"required"`
+	Size       int    `json:"size" binding:"required"`
+	Note       string `json:"note"`
+}
+
+// Отвечает на ошибки работы с партиями
+func batchError(c *gin.Context, err error, op string) {
+	switch {
+	case errors.Is(err, errs.ErrInvalidBatchSize):
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("Размер партии должен быть от 1 до %d", service.MaxBatchSize))
+	case errors.Is(err, errs.ErrBatchNotFound):
+		c.JSON(http.StatusNotFound, "Партия не найдена")
+	case errors.Is(err, errs.ErrCatalogPrizeNotFound), errors.Is(err, errs.ErrCampaignNotFound):
+		c.JSON(http.StatusNotFound, "Приз или акция не найдены")
+	case errors.Is(err, errs.ErrPrizeExhausted):
+		c.JSON(http.StatusConflict, "Партия не помещается в лимит приза")
+	case errors.Is(err, errs.ErrBatchVoided):
+		c.JSON(http.StatusConflict, "Партия уже аннулирована")
+	default:
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Printf("error h.service.%s: %v", op, err)
+	}
+}
+
+func batchID(c *gin.Context) (int64, bool) {
+	return pathID(c, "партии")
+}
+
+// AdminCreateBatch - POST /admin/batches: партия печатных кодов на один приз
+func (h *Handler) AdminCreateBatch(c *gin.Context) {
+	var req createBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "У вас невалидный запрос")
+		return
+	}
+
+	batch, err := h.service.CreateBatch(c, req.CatalogID, req.CampaignID, req.Size, req.Note)
+	if err != nil {
+		batchError(c, err, "CreateBatch")
+		return
+	}
+
+	c.JSON(http.StatusCreated, batch)
+}
+
+// AdminGetBatch - GET /admin/batches/:id
+func (h *Handler) AdminGetBatch(c *gin.Context) {
+	id, ok := batchID(c)
+	if !ok {
+		return
+	}
+
+	batch, err := h.service.GetBatch(c, id)
+	if err != nil {
+		batchError(c, err, "GetBatch")
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+// AdminExportBatch - GET /admin/batches/:id/codes.csv: выгрузка кодов для типографии
+func (h *Handler) AdminExportBatch(c *gin.Context) {
+	id, ok := batchID(c)
+	if !ok {
+		return
+	}
+
+	if _, err := h.service.GetBatch(c, id); err != nil {
+		batchError(c, err, "GetBatch")
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="batch-%d.csv"`, id))
+	c.Status(http.StatusOK)
+
+	if err := h.service.ExportBatchCSV(c, id, c.Writer); err != nil {
+		log.Println("error h.service.ExportBatchCSV:", err)
+	}
+}
+
+// AdminVoidBatch - POST /admin/batches/:id/void: аннулирование всей партии
+func (h *Handler) AdminVoidBatch(c *gin.Context) {
+	id, ok := batchID(c)
+	if !ok {
+		return
+	}
+
+	voided, err := h.service.VoidBatch(c, id)
+	if err != nil {
+		batchError(c, err, "VoidBatch")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"batch_id": id,
+		"voided":   voided,
+	})
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Время в RFC 3339, например 2026-11-01T00:00:00+03:00
+type campaignRequest struct {
+	Name           string    `json:"name" binding:"required"`
+	IssueStartsAt  time.Time `json:"issue_starts_at" binding:"required"`
+	IssueEndsAt    time.Time `json:"issue_ends_at" binding:"required"`
+	RedeemStartsAt time.Time `json:"redeem_starts_at" binding:"required"`
+	RedeemEndsAt   time.Time `json:"redeem_ends_at" binding:"required"`
+	Address        string    `json:"address"`
+}
+
+func (r campaignRequest) campaign() model.Campaign {
+	return model.Campaign{
+		Name:           r.Name,
+		IssueStartsAt:  r.IssueStartsAt,
+		IssueEndsAt:    r.IssueEndsAt,
+		RedeemStartsAt: r.RedeemStartsAt,
+		RedeemEndsAt:   r.RedeemEndsAt,
+		Address:        r.Address,
+	}
+}
+
+// Отвечает на ошибки работы с акциями
+func campaignError(c *gin.Context, err error, op string) {
+	switch {
+	case errors.Is(err, errs.ErrInvalidCampaignWindow):
+		c.JSON(http.StatusBadRequest, "Начало окна выдачи и погашения должно быть раньше конца")
+	case errors.Is(err, errs.ErrCampaignNotFound):
+		c.JSON(http.StatusNotFound, "Акция не найдена")
+	default:
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Printf("error h.service.%s: %v", op, err)
+	}
+}
+
+// AdminListCampaigns - GET /admin/campaigns
+func (h *Handler) AdminListCampaigns(c *gin.Context) {
+	campaigns, err := h.service.ListCampaigns(c)
+	if err != nil {
+		campaignError(c, err, "ListCampaigns")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaigns)
+}
+
+// AdminCreateCampaign - POST /admin/campaigns
+func (h *Handler) AdminCreateCampaign(c *gin.Context) {
+	var req campaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "У вас невалидный запрос")
+		return
+	}
+
+	campaign, err := h.service.CreateCampaign(c, req.campaign())
+	if err != nil {
+		campaignError(c, err, "CreateCampaign")
+		return
+	}
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// AdminUpdateCampaign - PUT /admin/campaigns/:id
+func (h *Handler) AdminUpdateCampaign(c *gin.Context) {
+	id, ok := pathID(c, "акции")
+	if !ok {
+		return
+	}
+
+	var req campaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "У вас невалидный запрос")
+		return
+	}
+
+	campaign := req.campaign()
+	campaign.ID = id
+	campaign, err := h.service.UpdateCampaign(c, campaign)
+	if err != nil {
+		campaignError(c, err, "UpdateCampaign")
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
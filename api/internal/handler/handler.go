@@ -1,11 +1,16 @@
 package handler
 
 import (
-	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
 	"github.com/berduk-dev/bad-da-yo/internal/service"
 	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
+	"time"
 )
 
 type Handler struct {
@@ -18,23 +23,162 @@ func New(service service.Service) Handler {
 	}
 }
 
-func (h *Handler) CreatePrize(c *gin.Context) {
-	var req model.PrizeRequest
-	err := c.ShouldBindJSON(&req)
+const (
+	spinSessionCookie = "spin_session"
+	spinTokenHeader   = "X-Spin-Token"
+
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// GetSpinToken выдает одноразовый токен на вращение колеса для текущей сессии
+func (h *Handler) GetSpinToken(c *gin.Context) {
+	sessionID, err := h.spinSession(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, "У вас невалидный запрос")
-		log.Println("error PrizeCode ShouldBindJSON:", err)
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.spinSession:", err)
 		return
 	}
 
-	code, err := h.service.CreatePrize(c, req.Prize)
+	token, expiresAt, err := h.service.IssueSpinToken(sessionID)
 	if err != nil {
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.IssueSpinToken:", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
+
+func (h *Handler) CreatePrize(c *gin.Context) {
+	sessionID, _ := c.Cookie(spinSessionCookie)
+
+	idempotencyKey := c.GetHeader(idempotencyKeyHeader)
+	if !validIdempotencyKey(idempotencyKey) {
+		c.JSON(http.StatusBadRequest, "Некорректный Idempotency-Key")
+		return
+	}
+
+	prize, err := h.service.CreatePrize(c, sessionID, c.GetHeader(spinTokenHeader), idempotencyKey)
+	if err != nil {
+		if errors.Is(err, errs.ErrIdempotencyKeyUsed) {
+			c.JSON(http.StatusConflict, "Запрос с этим ключом уже обрабатывается")
+			return
+		}
+		if errors.Is(err, errs.ErrNoActiveCampaign) {
+			c.JSON(http.StatusForbidden, "Акция сейчас не проводится")
+			return
+		}
+		if errors.Is(err, errs.ErrInvalidSpinToken) || errors.Is(err, errs.ErrSpinTokenSpent) {
+			c.JSON(http.StatusForbidden, "Недействительный токен, обновите страницу")
+			return
+		}
+		if errors.Is(err, errs.ErrNoPrizesAvailable) {
+			c.JSON(http.StatusServiceUnavailable, "Призы закончились")
+			return
+		}
 		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
 		log.Println("error h.service.CreatePrize:", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"code": code,
+		"prize":     prize.Prize,
+		"code":      prize.Code,
+		"campaign":  prize.Campaign.Name,
+		"deep_link": prize.DeepLink,
+	})
+}
+
+// Ключ идемпотентности - до maxIdempotencyKeyLen видимых ASCII-символов (UUID и т.п.); пустой - без идемпотентности
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLen {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < '!' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// GetPrizeStatus отдает фронтенду состояние кода без персональных данных
+func (h *Handler) GetPrizeStatus(c *gin.Context) {
+	prize, err := h.service.GetPrizeByCode(c, c.Param("code"))
+	if err != nil {
+		if errors.Is(err, errs.ErrPrizeNotFound) {
+			c.JSON(http.StatusNotFound, "Код не найден")
+			return
+		}
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.GetPrizeByCode:", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":        prize.Code,
+		"prize":       prize.Prize,
+		"status":      prize.Status(time.Now()),
+		"claimed":     prize.Claimed,
+		"redeemed":    prize.UsedAt != nil,
+		"redeemed_at": prize.UsedAt,
+		"expires_at":  prize.ExpiresAt,
+		"deep_link":   prize.DeepLink,
+		"campaign": gin.H{
+			"name":             prize.Campaign.Name,
+			"redeem_starts_at": prize.Campaign.RedeemStartsAt,
+			"redeem_ends_at":   prize.Campaign.RedeemEndsAt,
+			"address":          prize.Campaign.Address,
+		},
 	})
 }
+
+// GetPrizes отдает фронтенду секторы колеса и отмечает закончившиеся призы
+func (h *Handler) GetPrizes(c *gin.Context) {
+	catalog, err := h.service.GetCatalog(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.GetCatalog:", err)
+		return
+	}
+
+	prizes := make([]gin.H, 0, len(catalog))
+	for _, p := range catalog {
+		prize := gin.H{
+			"id":       p.ID,
+			"name":     p.Name,
+			"sold_out": p.SoldOut,
+		}
+		if p.TotalCap != nil {
+			prize["remaining"] = max(*p.TotalCap-p.IssuedTotal, 0)
+		}
+		prizes = append(prizes, prize)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"prizes": prizes,
+	})
+}
+
+// Возвращает идентификатор сессии клиента из cookie, при необходимости создавая новую
+func (h *Handler) spinSession(c *gin.Context) (string, error) {
+	if sessionID, err := c.Cookie(spinSessionCookie); err == nil && sessionID != "" {
+		return sessionID, nil
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	sessionID := hex.EncodeToString(b)
+
+	// Фронтенд на другом домене, поэтому cookie должна быть SameSite=None; Secure
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(spinSessionCookie, sessionID, int((30 * 24 * time.Hour).Seconds()), "/", "", true, true)
+
+	return sessionID, nil
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want bool
+	}{
+		{name: "empty", key: "", want: true},
+		{name: "uuid", key: "3f0c1a52-8a0e-4f43-9d55-8f1e8b7c2d11", want: true},
+		{name: "visible ascii", key: "spin:1/retry#2", want: true},
+		{name: "max length", key: strings.Repeat("k", maxIdempotencyKeyLen), want: true},
+		{name: "too long", key: strings.Repeat("k", maxIdempotencyKeyLen+1), want: false},
+		{name: "space", key: "spin 1", want: false},
+		{name: "control character", key: "spin\t1", want: false},
+		{name: "non ascii", key: "ключ", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validIdempotencyKey(tt.key); got != tt.want {
+				t.Fatalf("validIdempotencyKey(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultQRSize = 256
+	maxQRSize     = 1024
+)
+
+// Ссылка на бота для QR по коду из пути; при ошибке отвечает сам
+func (h *Handler) prizeDeepLink(c *gin.Context) (string, bool) {
+	prize, err := h.service.GetPrizeByCode(c, c.Param("code"))
+	if err != nil {
+		if errors.Is(err, errs.ErrPrizeNotFound) {
+			c.JSON(http.StatusNotFound, "Код не найден")
+			return "", false
+		}
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.GetPrizeByCode:", err)
+		return "", false
+	}
+
+	if prize.DeepLink == "" {
+		c.JSON(http.StatusNotImplemented, "Имя бота не настроено")
+		return "", false
+	}
+
+	return prize.DeepLink, true
+}
+
+// GetPrizeQRPNG - GET /prize/:code/qr.png?size=256: QR со ссылкой на бота для сканирования с телефона
+func (h *Handler) GetPrizeQRPNG(c *gin.Context) {
+	link, ok := h.prizeDeepLink(c)
+	if !ok {
+		return
+	}
+
+	size := defaultQRSize
+	if v := c.Query("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxQRSize {
+			c.JSON(http.StatusBadRequest, fmt.Sprintf("size должен быть от 1 до %d", maxQRSize))
+			return
+		}
+		size = n
+	}
+
+	png, err := qrcode.Encode(link, qrcode.Medium, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error qrcode.Encode:", err)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// GetPrizeQRSVG - GET /prize/:code/qr.svg: то же в векторе
+func (h *Handler) GetPrizeQRSVG(c *gin.Context) {
+	link, ok := h.prizeDeepLink(c)
+	if !ok {
+		return
+	}
+
+	qr, err := qrcode.New(link, qrcode.Medium)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error qrcode.New:", err)
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/svg+xml", qrSVG(qr.Bitmap()))
+}
+
+// Рисует матрицу QR одним path: по квадрату 1x1 на каждый темный модуль
+func qrSVG(bitmap [][]bool) []byte {
+	n := len(bitmap)
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	return []byte(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+			`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`,
+		n, n, path.String(),
+	))
+}
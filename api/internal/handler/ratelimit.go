@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SpinLimit - middleware для POST /prize: не больше заданного числа вращений по IP и по cookie клиента.
+// Без cookie сессии вращение невозможно, а попытка резервируется только после проверки токена вращения,
+// чтобы мусорные запросы не расходовали чужой лимит по IP. Если код так и не был выдан, попытка возвращается.
+func (h *Handler) SpinLimit(c *gin.Context) {
+	sessionID, err := c.Cookie(spinSessionCookie)
+	if err != nil || sessionID == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, "Недействительный токен, обновите страницу")
+		return
+	}
+
+	replay, err := h.service.IsSpinReplay(c, sessionID, c.GetHeader(idempotencyKeyHeader))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.IsSpinReplay:", err)
+		return
+	}
+	if replay {
+		c.Next()
+		return
+	}
+
+	if err = h.service.CheckSpinToken(sessionID, c.GetHeader(spinTokenHeader)); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, "Недействительный токен, обновите страницу")
+		return
+	}
+
+	decision, err := h.service.ReserveSpin(c, c.ClientIP(), sessionID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Println("error h.service.ReserveSpin:", err)
+		return
+	}
+
+	if !decision.Allowed {
+		retryAfter := int(math.Ceil(time.Until(decision.NextAt).Seconds()))
+		c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":        "Вы уже крутили колесо, попробуйте позже",
+			"next_spin_at": decision.NextAt,
+			"retry_after":  max(retryAfter, 1),
+		})
+		return
+	}
+
+	c.Next()
+
+	if c.Writer.Status() != http.StatusOK {
+		// Запрос мог быть отменен клиентом, поэтому возвращаем попытку в отдельном контексте
+		err = h.service.ReleaseSpin(context.WithoutCancel(c.Request.Context()), decision)
+		if err != nil {
+			log.Println("error h.service.ReleaseSpin:", err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpinLimitRequiresSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{name: "no cookie"},
+		{name: "empty cookie", cookie: &http.Cookie{Name: spinSessionCookie, Value: ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h Handler
+			reached := false
+
+			r := gin.New()
+			r.POST("/prize", h.SpinLimit, func(c *gin.Context) { reached = true })
+
+			req := httptest.NewRequest(http.MethodPost, "/prize", nil)
+			req.Header.Set(spinTokenHeader, "token")
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+			if reached {
+				t.Fatal("request without a session reached the prize handler")
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type storeRequest struct {
+	Name          string `json:"name" binding:"required"`
+	Address       string `json:"address"`
+	Hours         string `json:"hours"`
+	Timezone      string `json:"timezone"`
+	CashierChatID *int64 `json:"cashier_chat_id"`
+}
+
+func (r storeRequest) store() model.Store {
+	return model.Store{
+		Name:          r.Name,
+		Address:       r.Address,
+		Hours:         r.Hours,
+		Timezone:      r.Timezone,
+		CashierChatID: r.CashierChatID,
+	}
+}
+
+type catalogStoresRequest struct {
+	StoreIDs []int64 `json:"store_ids"`
+}
+
+// Отвечает на ошибки работы с магазинами
+func storeError(c *gin.Context, err error, op string) {
+	switch {
+	case errors.Is(err, errs.ErrInvalidTimezone):
+		c.JSON(http.StatusBadRequest, "Некорректный часовой пояс, нужен формат IANA, например Europe/Moscow")
+	case errors.Is(err, errs.ErrStoreNotFound):
+		c.JSON(http.StatusNotFound, "Магазин не найден")
+	case errors.Is(err, errs.ErrCatalogPrizeNotFound):
+		c.JSON(http.StatusNotFound, "Приз не найден")
+	case errors.Is(err, errs.ErrStoreChatTaken):
+		c.JSON(http.StatusConflict, "Этот чат кассиров уже привязан к другому магазину")
+	default:
+		c.JSON(http.StatusInternalServerError, "Произошла ошибка! Попробуйте позже")
+		log.Printf("error h.service.%s: %v", op, err)
+	}
+}
+
+func pathID(c *gin.Context, what string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, "Некорректный id "+what)
+		return 0, false
+	}
+	return id, true
+}
+
+// AdminListStores - GET /admin/stores
+func (h *Handler) AdminListStores(c *gin.Context) {
+	stores, err := h.service.ListStores(c)
+	if err != nil {
+		storeError(c, err, "ListStores")
+		return
+	}
+
+	c.JSON(http.StatusOK, stores)
+}
+
+// AdminCreateStore - POST /admin/stores
+func (h *Handler) AdminCreateStore(c *gin.Context) {
+	var req storeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "У вас невалидный запрос")
+		return
+	}
+
+	store, err := h.service.CreateStore(c, req.store())
+	if err != nil {
+		storeError(c, err, "CreateStore")
+		return
+	}
+
+	c.JSON(http.StatusCreated, store)
+}
+
+// AdminUpdateStore - PUT /admin/stores/:id
+func (h *Handler) AdminUpdateStore(c *gin.Context) {
+	id, ok := pathID(c, "магазина")
+	if !ok {
+		return
+	}
+
+	var req storeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "У вас невалидный запрос")
+		return
+	}
+
+	store := req.store()
+	store.ID = id
+	store, err := h.service.UpdateStore(c, store)
+	if err != nil {
+		storeError(c, err, "UpdateStore")
+		return
+	}
+
+	c.JSON(http.StatusOK, store)
+}
+
+// AdminSetCatalogStores - PUT /admin/catalog/:id/stores: магазины, где выдается приз (пустой список - везде)
+func (h *Handler) AdminSetCatalogStores(c *gin.Context) {
+	id, ok := pathID(c, "приза")
+	if !ok {
+		return
+	}
+
+	var req catalogStoresRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, "У вас невалидный запрос")
+		return
+	}
+
+	storeIDs, err := h.service.SetCatalogStores(c, id, req.StoreIDs)
+	if err != nil {
+		storeError(c, err, "SetCatalogStores")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"catalog_id": id, "store_ids": storeIDs})
+}
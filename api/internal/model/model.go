@@ -3,13 +3,187 @@ package model
 import "time"
 
 type Prize struct {
-	ID        int64      `json:"id"`
-	Code      string     `json:"code"`
-	Prize     string     `json:"prize"`
-	CreatedAt time.Time  `json:"created_at"`
-	UsedAt    *time.Time `json:"used_at"`
+	ID         int64      `json:"id"`
+	Code       string     `json:"code"`
+	Prize      string     `json:"prize"`
+	CatalogID  *int64     `json:"catalog_id"`
+	BatchID    *int64     `json:"batch_id"`
+	Campaign   Campaign   `json:"campaign"`
+	Claimed    bool       `json:"claimed"`
+	TelegramID *int64     `json:"telegram_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UsedAt     *time.Time `json:"used_at"`
+	VoidedAt   *time.Time `json:"voided_at"`
+	VoidReason *string    `json:"void_reason"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	DeepLink   string     `json:"deep_link,omitempty"`
 }
 
-type PrizeRequest struct {
-	Prize string `json:"prize"`
+// PrizeIssue - данные для атомарной выдачи кода вместе с токеном вращения и ключом идемпотентности
+type PrizeIssue struct {
+	CampaignID         int64
+	CatalogID          int64
+	Prize              string
+	Code               string
+	SessionID          string
+	SpinTokenID        string
+	SpinTokenExpiresAt time.Time
+	IdempotencyKey     string
+	IdempotencyTTL     time.Duration
+	ClaimTTL           time.Duration
+	// Часовой пояс, по которому считаются сутки дневного лимита
+	CapTimezone string
+}
+
+// CatalogPrize - приз из каталога колеса с весом для розыгрыша
+type CatalogPrize struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Weight      int    `json:"weight"`
+	Active      bool   `json:"active"`
+	TotalCap    *int   `json:"total_cap"`
+	DailyCap    *int   `json:"daily_cap"`
+	IssuedTotal int    `json:"issued_total"`
+	IssuedToday int    `json:"issued_today"`
+	SoldOut     bool   `json:"sold_out"`
+}
+
+// Campaign - акция с окнами выдачи и погашения кодов
+type Campaign struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	IssueStartsAt  time.Time `json:"issue_starts_at"`
+	IssueEndsAt    time.Time `json:"issue_ends_at"`
+	RedeemStartsAt time.Time `json:"redeem_starts_at"`
+	RedeemEndsAt   time.Time `json:"redeem_ends_at"`
+	Address        string    `json:"address"`
+}
+
+// RateLimitRule - лимит запросов на окно времени (например, 1 вращение за 24 часа)
+type RateLimitRule struct {
+	Bucket string        `json:"bucket"`
+	Limit  int           `json:"limit"`
+	Window time.Duration `json:"window"`
+}
+
+// RateLimitHit - попадание конкретного клиента (IP или cookie) под правило
+type RateLimitHit struct {
+	Rule        RateLimitRule `json:"rule"`
+	Subject     string        `json:"subject"`
+	WindowStart time.Time     `json:"window_start"`
+}
+
+// RateLimitDecision - результат резервирования попытки
+type RateLimitDecision struct {
+	Allowed bool           `json:"allowed"`
+	Hits    []RateLimitHit `json:"hits"`
+	NextAt  time.Time      `json:"next_at"`
+}
+
+// User - пользователь бота с привязанным кодом, если он есть
+type User struct {
+	TelegramID int64     `json:"telegram_id"`
+	Phone      *string   `json:"phone"`
+	PrizeCode  *string   `json:"prize_code"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Состояния кода для фильтров и публичного статуса
+const (
+	PrizeStatusIssued   = "issued"
+	PrizeStatusClaimed  = "claimed"
+	PrizeStatusRedeemed = "redeemed"
+	PrizeStatusVoided   = "voided"
+	PrizeStatusExpired  = "expired"
+)
+
+// Причины аннулирования кода
+const (
+	VoidReasonManual  = "manual"
+	VoidReasonExpired = "expired"
+	VoidReasonBatch   = "batch"
+)
+
+// Status возвращает состояние кода на момент now
+func (p Prize) Status(now time.Time) string {
+	switch {
+	case p.UsedAt != nil:
+		return PrizeStatusRedeemed
+	case p.VoidReason != nil && *p.VoidReason == VoidReasonExpired:
+		return PrizeStatusExpired
+	case p.VoidedAt != nil:
+		return PrizeStatusVoided
+	case p.ExpiresAt != nil && !now.Before(*p.ExpiresAt), !now.Before(p.Campaign.RedeemEndsAt):
+		return PrizeStatusExpired
+	case p.Claimed:
+		return PrizeStatusClaimed
+	default:
+		return PrizeStatusIssued
+	}
+}
+
+// PrizeFilter - фильтр и пагинация списка кодов в админке
+type PrizeFilter struct {
+	Status     string
+	CampaignID *int64
+	CatalogID  *int64
+	Code       string
+	Limit      int
+	Offset     int
+}
+
+// UserFilter - фильтр и пагинация списка пользователей в админке
+type UserFilter struct {
+	Phone  string
+	Limit  int
+	Offset int
+}
+
+// RedemptionFilter - фильтр и пагинация журнала погашений за период
+type RedemptionFilter struct {
+	From       *time.Time
+	To         *time.Time
+	CampaignID *int64
+	StoreID    *int64
+	Result     string
+	Limit      int
+	Offset     int
+}
+
+// Redemption - запись журнала погашений из бота: активация, отказ или отмена активации
+type Redemption struct {
+	ID              int64     `json:"id"`
+	PrizeID         *int64    `json:"prize_id"`
+	Code            string    `json:"code"`
+	Prize           *string   `json:"prize"`
+	CampaignID      *int64    `json:"campaign_id"`
+	Result          string    `json:"result"`
+	Reason          *string   `json:"reason"`
+	StoreID         *int64    `json:"store_id"`
+	StoreName       *string   `json:"store_name"`
+	ActorTelegramID int64     `json:"actor_telegram_id"`
+	ActorUsername   *string   `json:"actor_username"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// CodeBatch - партия кодов на один приз, сгенерированная для печати
+type CodeBatch struct {
+	ID         int64      `json:"id"`
+	CatalogID  int64      `json:"catalog_id"`
+	CampaignID int64      `json:"campaign_id"`
+	Size       int        `json:"size"`
+	Note       string     `json:"note"`
+	CreatedAt  time.Time  `json:"created_at"`
+	VoidedAt   *time.Time `json:"voided_at"`
+}
+
+// Store - магазин, где выдают призы. В чате кассиров магазина бот проверяет и гасит коды
+type Store struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	Address       string    `json:"address"`
+	Hours         string    `json:"hours"`
+	Timezone      string    `json:"timezone"`
+	CashierChatID *int64    `json:"cashier_chat_id"`
+	CreatedAt     time.Time `json:"created_at"`
 }
@@ -0,0 +1,333 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/jackc/pgx/v5"
+	"strconv"
+	"strings"
+)
+
+// Накопитель условий WHERE с нумерацией плейсхолдеров
+type whereBuilder struct {
+	conds []string
+	args  []any
+}
+
+func (w *whereBuilder) add(cond string, arg any) {
+	w.args = append(w.args, arg)
+	w.conds = append(w.conds, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(w.args))))
+}
+
+func (w *whereBuilder) addRaw(cond string) {
+	w.conds = append(w.conds, cond)
+}
+
+func (w *whereBuilder) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// Добавляет LIMIT/OFFSET и возвращает итоговые аргументы запроса
+func (w *whereBuilder) page(limit, offset int) (string, []any) {
+	args := append(w.args, limit, offset)
+	return fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args)), args
+}
+
+// ListPrizes возвращает страницу кодов по фильтру и общее количество подходящих
+func (r *Repository) ListPrizes(ctx context.Context, f model.PrizeFilter) ([]model.Prize, int, error) {
+	var w whereBuilder
+	switch f.Status {
+	case model.PrizeStatusIssued:
+		w.addRaw("p.telegram_id IS NULL AND p.used_at IS NULL AND p.voided_at IS NULL AND p.expires_at > CURRENT_TIMESTAMP")
+	case model.PrizeStatusClaimed:
+		w.addRaw("p.telegram_id IS NOT NULL AND p.used_at IS NULL AND p.voided_at IS NULL AND p.expires_at > CURRENT_TIMESTAMP")
+	case model.PrizeStatusRedeemed:
+		w.addRaw("p.used_at IS NOT NULL")
+	case model.PrizeStatusVoided:
+		w.add("p.voided_at IS NOT NULL AND p.void_reason IS DISTINCT FROM ?", model.VoidReasonExpired)
+	case model.PrizeStatusExpired:
+		w.add("p.used_at IS NULL AND (p.void_reason = ? OR (p.voided_at IS NULL AND p.expires_at <= CURRENT_TIMESTAMP))", model.VoidReasonExpired)
+	}
+	if f.CampaignID != nil {
+		w.add("p.campaign_id = ?", *f.CampaignID)
+	}
+	if f.CatalogID != nil {
+		w.add("p.catalog_id = ?", *f.CatalogID)
+	}
+	if f.Code != "" {
+		// Поиск по началу кода; starts_with, а не LIKE, чтобы % и _ в фильтре не работали как шаблон
+		w.add("starts_with(p.code, ?)", f.Code)
+	}
+
+	var total int
+	err := r.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM prizes p `+w.String(), w.args...,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListPrizes COUNT: %w", err)
+	}
+
+	page, args := w.page(f.Limit, f.Offset)
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+prizeColumns+`
+		FROM prizes p
+		JOIN campaigns c ON c.id = p.campaign_id
+		`+w.String()+`
+		ORDER BY p.created_at DESC, p.id DESC
+		`+page, args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListPrizes SELECT: %w", err)
+	}
+	defer rows.Close()
+
+	prizes, err := collectPrizes(rows)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListPrizes: %w", err)
+	}
+
+	return prizes, total, nil
+}
+
+// ListRedemptions возвращает журнал погашений за период, новые сверху: активации, отказы и отмены
+// с магазином, в котором кассир работал с кодом
+func (r *Repository) ListRedemptions(ctx context.Context, f model.RedemptionFilter) ([]model.Redemption, int, error) {
+	var w whereBuilder
+	if f.From != nil {
+		w.add("rd.created_at >= ?", f.From.UTC())
+	}
+	if f.To != nil {
+		w.add("rd.created_at < ?", f.To.UTC())
+	}
+	if f.CampaignID != nil {
+		w.add("p.campaign_id = ?", *f.CampaignID)
+	}
+	if f.StoreID != nil {
+		w.add("rd.store_id = ?", *f.StoreID)
+	}
+	if f.Result != "" {
+		w.add("rd.result = ?", f.Result)
+	}
+
+	var total int
+	err := r.pool.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM redemptions rd
+		LEFT JOIN prizes p ON p.id = rd.prize_id
+		`+w.String(), w.args...,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListRedemptions COUNT: %w", err)
+	}
+
+	page, args := w.page(f.Limit, f.Offset)
+	rows, err := r.pool.Query(ctx, `
+		SELECT rd.id, rd.prize_id, rd.code, p.prize, p.campaign_id, rd.result, rd.reason,
+		       rd.store_id, s.name, rd.actor_telegram_id, rd.actor_username, rd.created_at
+		FROM redemptions rd
+		LEFT JOIN prizes p ON p.id = rd.prize_id
+		LEFT JOIN stores s ON s.id = rd.store_id
+		`+w.String()+`
+		ORDER BY rd.created_at DESC, rd.id DESC
+		`+page, args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListRedemptions SELECT: %w", err)
+	}
+	defer rows.Close()
+
+	redemptions := []model.Redemption{}
+	for rows.Next() {
+		var rd model.Redemption
+		err := rows.Scan(
+			&rd.ID, &rd.PrizeID, &rd.Code, &rd.Prize, &rd.CampaignID, &rd.Result, &rd.Reason,
+			&rd.StoreID, &rd.StoreName, &rd.ActorTelegramID, &rd.ActorUsername, &rd.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("ListRedemptions scan: %w", err)
+		}
+		redemptions = append(redemptions, rd)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("ListRedemptions rows.Err: %w", err)
+	}
+
+	return redemptions, total, nil
+}
+
+func collectPrizes(rows pgx.Rows) ([]model.Prize, error) {
+	prizes := []model.Prize{}
+	for rows.Next() {
+		var p model.Prize
+		if err := scanPrize(rows, &p); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		prizes = append(prizes, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows.Err: %w", err)
+	}
+
+	return prizes, nil
+}
+
+// ListUsers возвращает страницу пользователей бота вместе с их кодами
+func (r *Repository) ListUsers(ctx context.Context, f model.UserFilter) ([]model.User, int, error) {
+	var w whereBuilder
+	if f.Phone != "" {
+		w.add("u.phone LIKE '%' || ? || '%'", f.Phone)
+	}
+
+	var total int
+	err := r.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM users u `+w.String(), w.args...,
+	).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListUsers COUNT: %w", err)
+	}
+
+	page, args := w.page(f.Limit, f.Offset)
+	rows, err := r.pool.Query(ctx, `
+		SELECT u.telegram_id, u.phone, u.created_at,
+		       (SELECT p.code FROM prizes p WHERE p.telegram_id = u.telegram_id ORDER BY p.id LIMIT 1)
+		FROM users u
+		`+w.String()+`
+		ORDER BY u.created_at DESC, u.id DESC
+		`+page, args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("ListUsers SELECT: %w", err)
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		var u model.User
+		if err := rows.Scan(&u.TelegramID, &u.Phone, &u.CreatedAt, &u.PrizeCode); err != nil {
+			return nil, 0, fmt.Errorf("ListUsers scan: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("ListUsers rows.Err: %w", err)
+	}
+
+	return users, total, nil
+}
+
+// VoidPrize аннулирует непогашенный код и возвращает приз в общий лимит каталога
+func (r *Repository) VoidPrize(ctx context.Context, code string) (model.Prize, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("VoidPrize begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var (
+		catalogID *int64
+		usedAt    bool
+		voided    bool
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT catalog_id, used_at IS NOT NULL, voided_at IS NOT NULL
+		FROM prizes
+		WHERE code = $1
+		FOR UPDATE`,
+		code,
+	).Scan(&catalogID, &usedAt, &voided)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Prize{}, errs.ErrPrizeNotFound
+	}
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("VoidPrize SELECT: %w", err)
+	}
+	if usedAt {
+		return model.Prize{}, errs.ErrPrizeRedeemed
+	}
+	if voided {
+		return model.Prize{}, errs.ErrPrizeVoided
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE prizes SET voided_at = CURRENT_TIMESTAMP, void_reason = $2 WHERE code = $1`,
+		code, model.VoidReasonManual,
+	)
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("VoidPrize UPDATE prizes: %w", err)
+	}
+
+	if catalogID != nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE prize_catalog SET issued_total = GREATEST(issued_total - 1, 0) WHERE id = $1`,
+			*catalogID,
+		)
+		if err != nil {
+			return model.Prize{}, fmt.Errorf("VoidPrize UPDATE prize_catalog: %w", err)
+		}
+	}
+
+	var p model.Prize
+	err = scanPrize(tx.QueryRow(ctx, `
+		SELECT `+prizeColumns+`
+		FROM prizes p
+		JOIN campaigns c ON c.id = p.campaign_id
+		WHERE p.code = $1`,
+		code,
+	), &p)
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("VoidPrize SELECT updated: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return model.Prize{}, fmt.Errorf("VoidPrize commit: %w", err)
+	}
+
+	return p, nil
+}
+
+// GetCatalogPrize возвращает приз каталога по id
+func (r *Repository) GetCatalogPrize(ctx context.Context, id int64) (model.CatalogPrize, error) {
+	var p model.CatalogPrize
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, name, weight, active, total_cap, daily_cap, issued_total
+		FROM prize_catalog
+		WHERE id = $1`,
+		id,
+	).Scan(&p.ID, &p.Name, &p.Weight, &p.Active, &p.TotalCap, &p.DailyCap, &p.IssuedTotal)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.CatalogPrize{}, errs.ErrCatalogPrizeNotFound
+	}
+	if err != nil {
+		return model.CatalogPrize{}, fmt.Errorf("GetCatalogPrize SELECT: %w", err)
+	}
+
+	return p, nil
+}
+
+// GetCampaign возвращает акцию по id
+func (r *Repository) GetCampaign(ctx context.Context, id int64) (model.Campaign, error) {
+	var c model.Campaign
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, name, issue_starts_at, issue_ends_at, redeem_starts_at, redeem_ends_at, address
+		FROM campaigns
+		WHERE id = $1`,
+		id,
+	).Scan(&c.ID, &c.Name, &c.IssueStartsAt, &c.IssueEndsAt, &c.RedeemStartsAt, &c.RedeemEndsAt, &c.Address)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Campaign{}, errs.ErrCampaignNotFound
+	}
+	if err != nil {
+		return model.Campaign{}, fmt.Errorf("GetCampaign SELECT: %w", err)
+	}
+
+	return c, nil
+}
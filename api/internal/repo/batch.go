@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/jackc/pgx/v5"
+)
+
+// Сколько раз догенерировать коды партии, столкнувшиеся с уже существующими
+const maxBatchFillRounds = 5
+
+// CreateBatch в одной транзакции списывает размер партии из общего лимита приза
+// и сохраняет коды. Коды, совпавшие с уже выданными, заменяются кодами из generate.
+// Дневной лимит к печатным кодам не применяется; срок кода - до конца погашения акции.
+func (r *Repository) CreateBatch(ctx context.Context, batch model.CodeBatch, codes []string, generate func() (string, error)) (model.CodeBatch, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.CodeBatch{}, fmt.Errorf("CreateBatch begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var prizeName string
+	err = tx.QueryRow(ctx, `
+		UPDATE prize_catalog
+		SET issued_total = issued_total + $2
+		WHERE id = $1 AND (total_cap IS NULL OR issued_total + $2 <= total_cap)
+		RETURNING name`,
+		batch.CatalogID, batch.Size,
+	).Scan(&prizeName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.CodeBatch{}, errs.ErrPrizeExhausted
+	}
+	if err != nil {
+		return model.CodeBatch{}, fmt.Errorf("CreateBatch UPDATE prize_catalog: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO code_batches (catalog_id, campaign_id, size, note)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		batch.CatalogID, batch.CampaignID, batch.Size, batch.Note,
+	).Scan(&batch.ID, &batch.CreatedAt)
+	if err != nil {
+		return model.CodeBatch{}, fmt.Errorf("CreateBatch INSERT code_batches: %w", err)
+	}
+
+	pending := codes
+	for round := 0; len(pending) > 0; round++ {
+		if round == maxBatchFillRounds {
+			return model.CodeBatch{}, errs.ErrCodeExists
+		}
+
+		cmd, err := tx.Exec(ctx, `
+			INSERT INTO prizes (code, prize, catalog_id, campaign_id, batch_id, expires_at)
+			SELECT code, $2, $3, c.id, $5, c.redeem_ends_at
+			FROM unnest($1::text[]) AS code, campaigns c
+			WHERE c.id = $4
+			ON CONFLICT (code) DO NOTHING`,
+			pending, prizeName, batch.CatalogID, batch.CampaignID, batch.ID,
+		)
+		if err != nil {
+			return model.CodeBatch{}, fmt.Errorf("CreateBatch INSERT prizes: %w", err)
+		}
+
+		missing := len(pending) - int(cmd.RowsAffected())
+		pending = pending[:0:0]
+		for range missing {
+			code, err := generate()
+			if err != nil {
+				return model.CodeBatch{}, err
+			}
+			pending = append(pending, code)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return model.CodeBatch{}, fmt.Errorf("CreateBatch commit: %w", err)
+	}
+
+	return batch, nil
+}
+
+// GetBatch возвращает партию по id
+func (r *Repository) GetBatch(ctx context.Context, id int64) (model.CodeBatch, error) {
+	var b model.CodeBatch
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, catalog_id, campaign_id, size, note, created_at, voided_at
+		FROM code_batches
+		WHERE id = $1`,
+		id,
+	).Scan(&b.ID, &b.CatalogID, &b.CampaignID, &b.Size, &b.Note, &b.CreatedAt, &b.VoidedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.CodeBatch{}, errs.ErrBatchNotFound
+	}
+	if err != nil {
+		return model.CodeBatch{}, fmt.Errorf("GetBatch SELECT: %w", err)
+	}
+
+	return b, nil
+}
+
+// ListBatchPrizes возвращает все коды партии в порядке создания
+func (r *Repository) ListBatchPrizes(ctx context.Context, batchID int64) ([]model.Prize, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+prizeColumns+`
+		FROM prizes p
+		JOIN campaigns c ON c.id = p.campaign_id
+		WHERE p.batch_id = $1
+		ORDER BY p.id`,
+		batchID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ListBatchPrizes SELECT: %w", err)
+	}
+	defer rows.Close()
+
+	prizes, err := collectPrizes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("ListBatchPrizes: %w", err)
+	}
+
+	return prizes, nil
+}
+
+// VoidBatch аннулирует все непогашенные коды партии (например, если тираж потерян)
+// и возвращает их в общий лимит приза. Возвращает число аннулированных кодов.
+func (r *Repository) VoidBatch(ctx context.Context, batchID int64) (int64, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("VoidBatch begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var catalogID int64
+	err = tx.QueryRow(ctx, `
+		UPDATE code_batches
+		SET voided_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND voided_at IS NULL
+		RETURNING catalog_id`,
+		batchID,
+	).Scan(&catalogID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if _, err := r.GetBatch(ctx, batchID); err != nil {
+			return 0, err
+		}
+		return 0, errs.ErrBatchVoided
+	}
+	if err != nil {
+		return 0, fmt.Errorf("VoidBatch UPDATE code_batches: %w", err)
+	}
+
+	cmd, err := tx.Exec(ctx, `
+		UPDATE prizes
+		SET voided_at = CURRENT_TIMESTAMP, void_reason = $2
+		WHERE batch_id = $1 AND used_at IS NULL AND voided_at IS NULL`,
+		batchID, model.VoidReasonBatch,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("VoidBatch UPDATE prizes: %w", err)
+	}
+	voided := cmd.RowsAffected()
+
+	_, err = tx.Exec(ctx, `
+		UPDATE prize_catalog SET issued_total = GREATEST(issued_total - $2, 0) WHERE id = $1`,
+		catalogID, voided,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("VoidBatch UPDATE prize_catalog: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("VoidBatch commit: %w", err)
+	}
+
+	return voided, nil
+}
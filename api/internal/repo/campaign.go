@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const campaignColumns = `id, name, issue_starts_at, issue_ends_at, redeem_starts_at, redeem_ends_at, address`
+
+func scanCampaign(row pgx.Row, c *model.Campaign) error {
+	return row.Scan(&c.ID, &c.Name, &c.IssueStartsAt, &c.IssueEndsAt, &c.RedeemStartsAt, &c.RedeemEndsAt, &c.Address)
+}
+
+// Окна акции проверяет и сервис, CHECK в таблице - последняя линия
+func campaignWriteError(err error, op string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23514" {
+		return errs.ErrInvalidCampaignWindow
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// ListCampaigns возвращает все акции, новые сверху
+func (r *Repository) ListCampaigns(ctx context.Context) ([]model.Campaign, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+campaignColumns+` FROM campaigns ORDER BY issue_starts_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("ListCampaigns SELECT: %w", err)
+	}
+	defer rows.Close()
+
+	campaigns := []model.Campaign{}
+	for rows.Next() {
+		var c model.Campaign
+		if err := scanCampaign(rows, &c); err != nil {
+			return nil, fmt.Errorf("ListCampaigns scan: %w", err)
+		}
+		campaigns = append(campaigns, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListCampaigns rows.Err: %w", err)
+	}
+
+	return campaigns, nil
+}
+
+// CreateCampaign добавляет акцию
+func (r *Repository) CreateCampaign(ctx context.Context, c model.Campaign) (model.Campaign, error) {
+	var created model.Campaign
+	err := scanCampaign(r.pool.QueryRow(ctx, `
+		INSERT INTO campaigns (name, issue_starts_at, issue_ends_at, redeem_starts_at, redeem_ends_at, address)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+campaignColumns,
+		c.Name, c.IssueStartsAt.UTC(), c.IssueEndsAt.UTC(), c.RedeemStartsAt.UTC(), c.RedeemEndsAt.UTC(), c.Address,
+	), &created)
+	if err != nil {
+		return model.Campaign{}, campaignWriteError(err, "CreateCampaign INSERT")
+	}
+
+	return created, nil
+}
+
+// UpdateCampaign перезаписывает акцию. Сроки уже выданных кодов (prizes.expires_at) не пересчитываются
+func (r *Repository) UpdateCampaign(ctx context.Context, c model.Campaign) (model.Campaign, error) {
+	var updated model.Campaign
+	err := scanCampaign(r.pool.QueryRow(ctx, `
+		UPDATE campaigns
+		SET name = $2, issue_starts_at = $3, issue_ends_at = $4, redeem_starts_at = $5, redeem_ends_at = $6, address = $7
+		WHERE id = $1
+		RETURNING `+campaignColumns,
+		c.ID, c.Name, c.IssueStartsAt.UTC(), c.IssueEndsAt.UTC(), c.RedeemStartsAt.UTC(), c.RedeemEndsAt.UTC(), c.Address,
+	), &updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Campaign{}, errs.ErrCampaignNotFound
+	}
+	if err != nil {
+		return model.Campaign{}, campaignWriteError(err, "UpdateCampaign UPDATE")
+	}
+
+	return updated, nil
+}
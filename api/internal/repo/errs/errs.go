@@ -0,0 +1,25 @@
+package errs
+
+import "errors"
+
+var (
+	ErrNoPrizesAvailable     = errors.New("no prizes available")
+	ErrPrizeExhausted        = errors.New("prize limit reached")
+	ErrNoActiveCampaign      = errors.New("no active campaign")
+	ErrInvalidSpinToken      = errors.New("invalid spin token")
+	ErrSpinTokenSpent        = errors.New("spin token already spent")
+	ErrIdempotencyKeyUsed    = errors.New("idempotency key already used")
+	ErrCodeExists            = errors.New("code already exists")
+	ErrPrizeNotFound         = errors.New("prize not found")
+	ErrPrizeRedeemed         = errors.New("prize already redeemed")
+	ErrPrizeVoided           = errors.New("prize already voided")
+	ErrCatalogPrizeNotFound  = errors.New("catalog prize not found")
+	ErrCampaignNotFound      = errors.New("campaign not found")
+	ErrInvalidCampaignWindow = errors.New("campaign window start must be before its end")
+	ErrBatchNotFound         = errors.New("batch not found")
+	ErrBatchVoided           = errors.New("batch already voided")
+	ErrInvalidBatchSize      = errors.New("invalid batch size")
+	ErrStoreNotFound         = errors.New("store not found")
+	ErrStoreChatTaken        = errors.New("cashier chat already bound to another store")
+	ErrInvalidTimezone       = errors.New("invalid timezone")
+)
@@ -2,8 +2,14 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
 )
 
 type Repository struct {
@@ -16,15 +22,384 @@ func New(pool *pgxpool.Pool) Repository {
 	}
 }
 
-func (r *Repository) CreatePrize(ctx context.Context, prizeName string, code string) error {
-	_, err := r.pool.Exec(ctx, `
-		INSERT INTO prizes (code, prize)
-		VALUES ($1, $2)`,
-		code, prizeName,
+// CreatePrize атомарно закрепляет ключ идемпотентности, тратит токен вращения,
+// списывает приз из лимитов каталога и сохраняет код.
+// Если общий или дневной лимит исчерпан, возвращает errs.ErrPrizeExhausted,
+// если ключ уже занят другим запросом - errs.ErrIdempotencyKeyUsed,
+// если такой код уже выдан - errs.ErrCodeExists.
+func (r *Repository) CreatePrize(ctx context.Context, issue model.PrizeIssue) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("CreatePrize begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Ключ занимаем первым: параллельный дубль ждет на первичном ключе до коммита этой транзакции
+	if issue.IdempotencyKey != "" {
+		cmd, err := tx.Exec(ctx, `
+			INSERT INTO prize_idempotency_keys (session_id, key)
+			VALUES ($1, $2)
+			ON CONFLICT (session_id, key) DO UPDATE
+			SET created_at = CURRENT_TIMESTAMP, prize_id = NULL
+			WHERE prize_idempotency_keys.created_at < CURRENT_TIMESTAMP - make_interval(secs => $3)`,
+			issue.SessionID, issue.IdempotencyKey, issue.IdempotencyTTL.Seconds(),
+		)
+		if err != nil {
+			return fmt.Errorf("CreatePrize INSERT prize_idempotency_keys: %w", err)
+		}
+		if cmd.RowsAffected() == 0 {
+			return errs.ErrIdempotencyKeyUsed
+		}
+	}
+
+	// Коды, выданные вручную из админки, идут без токена вращения
+	if issue.SpinTokenID != "" {
+		err = spendSpinToken(ctx, tx, issue.SpinTokenID, issue.SpinTokenExpiresAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	var dailyCap *int
+	err = tx.QueryRow(ctx, `
+		UPDATE prize_catalog
+		SET issued_total = issued_total + 1
+		WHERE id = $1 AND active AND (total_cap IS NULL OR issued_total < total_cap)
+		RETURNING daily_cap`,
+		issue.CatalogID,
+	).Scan(&dailyCap)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errs.ErrPrizeExhausted
+	}
+	if err != nil {
+		return fmt.Errorf("CreatePrize UPDATE prize_catalog: %w", err)
+	}
+
+	cmd, err := tx.Exec(ctx, `
+		INSERT INTO prize_daily_issues (catalog_id, day, issued)
+		SELECT $1, `+capDay("$3")+`, 1
+		WHERE $2::int IS NULL OR $2::int > 0
+		ON CONFLICT (catalog_id, day) DO UPDATE
+		SET issued = prize_daily_issues.issued + 1
+		WHERE $2::int IS NULL OR prize_daily_issues.issued < $2::int`,
+		issue.CatalogID, dailyCap, capTimezone(issue.CapTimezone),
 	)
 	if err != nil {
+		return fmt.Errorf("CreatePrize UPSERT prize_daily_issues: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrPrizeExhausted
+	}
+
+	var prizeID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO prizes (code, prize, catalog_id, campaign_id, expires_at)
+		SELECT $1, $2, $3, c.id,
+		       CASE WHEN $5::float8 > 0
+		            THEN LEAST(CURRENT_TIMESTAMP + make_interval(secs => $5), c.redeem_ends_at)
+		            ELSE c.redeem_ends_at
+		       END
+		FROM campaigns c
+		WHERE c.id = $4
+		RETURNING id`,
+		issue.Code, issue.Prize, issue.CatalogID, issue.CampaignID, issue.ClaimTTL.Seconds(),
+	).Scan(&prizeID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// 23505 - unique constraint violation
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "prizes_code_key" {
+			return errs.ErrCodeExists
+		}
 		return fmt.Errorf("CreatePrize INSERT: %w", err)
 	}
 
+	if issue.IdempotencyKey != "" {
+		_, err = tx.Exec(ctx, `
+			UPDATE prize_idempotency_keys
+			SET prize_id = $3
+			WHERE session_id = $1 AND key = $2`,
+			issue.SessionID, issue.IdempotencyKey, prizeID,
+		)
+		if err != nil {
+			return fmt.Errorf("CreatePrize UPDATE prize_idempotency_keys: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("CreatePrize commit: %w", err)
+	}
+
+	return nil
+}
+
+// GetPrizeByIdempotencyKey возвращает код, уже выданный по ключу в пределах срока хранения.
+// Если такого нет, возвращает nil.
+func (r *Repository) GetPrizeByIdempotencyKey(ctx context.Context, sessionID, key string, ttl time.Duration) (*model.Prize, error) {
+	var p model.Prize
+	err := scanPrize(r.pool.QueryRow(ctx, `
+		SELECT `+prizeColumns+`
+		FROM prize_idempotency_keys k
+		JOIN prizes p ON p.id = k.prize_id
+		JOIN campaigns c ON c.id = p.campaign_id
+		WHERE k.session_id = $1 AND k.key = $2
+		  AND k.created_at >= CURRENT_TIMESTAMP - make_interval(secs => $3)`,
+		sessionID, key, ttl.Seconds(),
+	), &p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GetPrizeByIdempotencyKey SELECT: %w", err)
+	}
+
+	return &p, nil
+}
+
+// capDay - текущие сутки дневного лимита в часовом поясе из параметра zoneParam.
+// CURRENT_DATE не годится: он идет по поясу сессии базы (UTC), и лимит сбрасывался бы в 03:00 по Москве
+func capDay(zoneParam string) string {
+	return capDayOf("CURRENT_TIMESTAMP", zoneParam)
+}
+
+// capDayOf - сутки дневного лимита, на которые пришелся момент ts
+func capDayOf(ts, zoneParam string) string {
+	return "(" + ts + " AT TIME ZONE " + zoneParam + "::text)::date"
+}
+
+func capTimezone(tz string) string {
+	if tz == "" {
+		return "UTC"
+	}
+	return tz
+}
+
+// GetActiveCatalog возвращает активные призы вместе с остатками по лимитам; сутки дневного лимита - в поясе tz
+func (r *Repository) GetActiveCatalog(ctx context.Context, tz string) ([]model.CatalogPrize, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT c.id, c.name, c.weight, c.active, c.total_cap, c.daily_cap, c.issued_total,
+		       COALESCE(d.issued, 0)
+		FROM prize_catalog c
+		LEFT JOIN prize_daily_issues d ON d.catalog_id = c.id AND d.day = `+capDay("$1")+`
+		WHERE c.active
+		ORDER BY c.id`, capTimezone(tz))
+	if err != nil {
+		return nil, fmt.Errorf("GetActiveCatalog SELECT: %w", err)
+	}
+	defer rows.Close()
+
+	var catalog []model.CatalogPrize
+	for rows.Next() {
+		var p model.CatalogPrize
+		err := rows.Scan(&p.ID, &p.Name, &p.Weight, &p.Active, &p.TotalCap, &p.DailyCap, &p.IssuedTotal, &p.IssuedToday)
+		if err != nil {
+			return nil, fmt.Errorf("GetActiveCatalog scan: %w", err)
+		}
+		p.SoldOut = (p.TotalCap != nil && p.IssuedTotal >= *p.TotalCap) ||
+			(p.DailyCap != nil && p.IssuedToday >= *p.DailyCap)
+		catalog = append(catalog, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("GetActiveCatalog rows.Err: %w", err)
+	}
+
+	return catalog, nil
+}
+
+// GetActiveCampaign возвращает акцию, в окно выдачи которой попадает текущий момент
+func (r *Repository) GetActiveCampaign(ctx context.Context) (model.Campaign, error) {
+	var c model.Campaign
+	err := r.pool.QueryRow(ctx, `
+		SELECT id, name, issue_starts_at, issue_ends_at, redeem_starts_at, redeem_ends_at, address
+		FROM campaigns
+		WHERE issue_starts_at <= now() AND now() < issue_ends_at
+		ORDER BY issue_starts_at DESC
+		LIMIT 1`,
+	).Scan(&c.ID, &c.Name, &c.IssueStartsAt, &c.IssueEndsAt, &c.RedeemStartsAt, &c.RedeemEndsAt, &c.Address)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Campaign{}, errs.ErrNoActiveCampaign
+	}
+	if err != nil {
+		return model.Campaign{}, fmt.Errorf("GetActiveCampaign SELECT: %w", err)
+	}
+
+	return c, nil
+}
+
+// Помечает токен вращения использованным и заодно чистит истекшие.
+// Если токен уже был использован, возвращает errs.ErrSpinTokenSpent.
+func spendSpinToken(ctx context.Context, tx pgx.Tx, tokenID string, expiresAt time.Time) error {
+	_, err := tx.Exec(ctx, `
+		DELETE FROM spent_spin_tokens WHERE expires_at < $1`,
+		time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("spendSpinToken DELETE: %w", err)
+	}
+
+	cmd, err := tx.Exec(ctx, `
+		INSERT INTO spent_spin_tokens (token_id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (token_id) DO NOTHING`,
+		tokenID, expiresAt.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("spendSpinToken INSERT: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrSpinTokenSpent
+	}
+
 	return nil
 }
+
+// ReserveRateLimits атомарно засчитывает попытку во все счетчики.
+// Если хотя бы один лимит исчерпан, ничего не засчитывается, а в ответе - когда освободится слот.
+func (r *Repository) ReserveRateLimits(ctx context.Context, hits []model.RateLimitHit) (model.RateLimitDecision, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.RateLimitDecision{}, fmt.Errorf("ReserveRateLimits begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	now := time.Now().UTC()
+	decision := model.RateLimitDecision{Allowed: true}
+
+	for _, hit := range hits {
+		windowFrom := now.Add(-hit.Rule.Window)
+
+		err := tx.QueryRow(ctx, `
+			INSERT INTO rate_limits (bucket, subject, window_start, hits)
+			VALUES ($1, $2, $3, 1)
+			ON CONFLICT (bucket, subject) DO UPDATE
+			SET window_start = CASE WHEN rate_limits.window_start <= $4 THEN $3 ELSE rate_limits.window_start END,
+			    hits = CASE WHEN rate_limits.window_start <= $4 THEN 1 ELSE rate_limits.hits + 1 END
+			WHERE rate_limits.window_start <= $4 OR rate_limits.hits < $5
+			RETURNING window_start`,
+			hit.Rule.Bucket, hit.Subject, now, windowFrom, hit.Rule.Limit,
+		).Scan(&hit.WindowStart)
+		if errors.Is(err, pgx.ErrNoRows) {
+			var windowStart time.Time
+			err = tx.QueryRow(ctx, `
+				SELECT window_start FROM rate_limits WHERE bucket = $1 AND subject = $2`,
+				hit.Rule.Bucket, hit.Subject,
+			).Scan(&windowStart)
+			if err != nil {
+				return model.RateLimitDecision{}, fmt.Errorf("ReserveRateLimits SELECT: %w", err)
+			}
+
+			decision.Allowed = false
+			if next := windowStart.Add(hit.Rule.Window); next.After(decision.NextAt) {
+				decision.NextAt = next
+			}
+			continue
+		}
+		if err != nil {
+			return model.RateLimitDecision{}, fmt.Errorf("ReserveRateLimits UPSERT: %w", err)
+		}
+
+		decision.Hits = append(decision.Hits, hit)
+	}
+
+	if !decision.Allowed {
+		decision.Hits = nil
+		return decision, nil
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return model.RateLimitDecision{}, fmt.Errorf("ReserveRateLimits commit: %w", err)
+	}
+
+	return decision, nil
+}
+
+// ReleaseRateLimits возвращает зарезервированные попытки, если окно с тех пор не сменилось
+func (r *Repository) ReleaseRateLimits(ctx context.Context, hits []model.RateLimitHit) error {
+	for _, hit := range hits {
+		_, err := r.pool.Exec(ctx, `
+			UPDATE rate_limits
+			SET hits = hits - 1
+			WHERE bucket = $1 AND subject = $2 AND window_start = $3 AND hits > 0`,
+			hit.Rule.Bucket, hit.Subject, hit.WindowStart,
+		)
+		if err != nil {
+			return fmt.Errorf("ReleaseRateLimits UPDATE: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetPrizeByCode возвращает код вместе с акцией и признаком привязки к Телеграму
+func (r *Repository) GetPrizeByCode(ctx context.Context, code string) (model.Prize, error) {
+	var p model.Prize
+	err := scanPrize(r.pool.QueryRow(ctx, `
+		SELECT `+prizeColumns+`
+		FROM prizes p
+		JOIN campaigns c ON c.id = p.campaign_id
+		WHERE p.code = $1`,
+		code,
+	), &p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Prize{}, errs.ErrPrizeNotFound
+	}
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("GetPrizeByCode SELECT: %w", err)
+	}
+
+	return p, nil
+}
+
+// Колонки кода с акцией для scanPrize; запрос должен называть таблицы prizes p и campaigns c
+const prizeColumns = `p.id, p.code, p.prize, p.catalog_id, p.batch_id, p.telegram_id, p.created_at, p.used_at,
+		       p.voided_at, p.void_reason, p.expires_at,
+		       c.id, c.name, c.issue_starts_at, c.issue_ends_at, c.redeem_starts_at, c.redeem_ends_at, c.address`
+
+func scanPrize(row pgx.Row, p *model.Prize) error {
+	err := row.Scan(
+		&p.ID, &p.Code, &p.Prize, &p.CatalogID, &p.BatchID, &p.TelegramID, &p.CreatedAt, &p.UsedAt,
+		&p.VoidedAt, &p.VoidReason, &p.ExpiresAt,
+		&p.Campaign.ID, &p.Campaign.Name, &p.Campaign.IssueStartsAt, &p.Campaign.IssueEndsAt,
+		&p.Campaign.RedeemStartsAt, &p.Campaign.RedeemEndsAt, &p.Campaign.Address,
+	)
+	p.Claimed = p.TelegramID != nil
+	return err
+}
+
+// ExpireCodes аннулирует просроченные непогашенные коды и возвращает их призы в лимиты каталога:
+// в общий и в дневной за сутки, когда код был выдан. Печатные коды партий дневной лимит не занимают
+func (r *Repository) ExpireCodes(ctx context.Context, tz string) (int64, error) {
+	var expired int64
+	err := r.pool.QueryRow(ctx, `
+		WITH expired AS (
+			UPDATE prizes
+			SET voided_at = CURRENT_TIMESTAMP, void_reason = $1
+			WHERE expires_at <= CURRENT_TIMESTAMP AND used_at IS NULL AND voided_at IS NULL
+			RETURNING catalog_id, batch_id, created_at
+		), returned AS (
+			UPDATE prize_catalog c
+			SET issued_total = GREATEST(c.issued_total - e.n, 0)
+			FROM (
+				SELECT catalog_id, COUNT(*) AS n FROM expired WHERE catalog_id IS NOT NULL GROUP BY catalog_id
+			) e
+			WHERE c.id = e.catalog_id
+		), returned_daily AS (
+			UPDATE prize_daily_issues d
+			SET issued = GREATEST(d.issued - e.n, 0)
+			FROM (
+				SELECT catalog_id, `+capDayOf("created_at", "$2")+` AS day, COUNT(*) AS n
+				FROM expired
+				WHERE catalog_id IS NOT NULL AND batch_id IS NULL
+				GROUP BY 1, 2
+			) e
+			WHERE d.catalog_id = e.catalog_id AND d.day = e.day
+		)
+		SELECT COUNT(*) FROM expired`,
+		model.VoidReasonExpired, capTimezone(tz),
+	).Scan(&expired)
+	if err != nil {
+		return 0, fmt.Errorf("ExpireCodes UPDATE: %w", err)
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const storeColumns = `id, name, address, hours, timezone, cashier_chat_id, created_at`
+
+func scanStore(row pgx.Row, s *model.Store) error {
+	return row.Scan(&s.ID, &s.Name, &s.Address, &s.Hours, &s.Timezone, &s.CashierChatID, &s.CreatedAt)
+}
+
+// Чат кассиров может принадлежать только одному магазину
+func storeWriteError(err error, op string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return errs.ErrStoreChatTaken
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// ListStores возвращает все магазины
+func (r *Repository) ListStores(ctx context.Context) ([]model.Store, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+storeColumns+` FROM stores ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("ListStores SELECT: %w", err)
+	}
+	defer rows.Close()
+
+	stores := []model.Store{}
+	for rows.Next() {
+		var s model.Store
+		if err := scanStore(rows, &s); err != nil {
+			return nil, fmt.Errorf("ListStores scan: %w", err)
+		}
+		stores = append(stores, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ListStores rows.Err: %w", err)
+	}
+
+	return stores, nil
+}
+
+// CreateStore добавляет магазин
+func (r *Repository) CreateStore(ctx context.Context, s model.Store) (model.Store, error) {
+	var created model.Store
+	err := scanStore(r.pool.QueryRow(ctx, `
+		INSERT INTO stores (name, address, hours, timezone, cashier_chat_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+storeColumns,
+		s.Name, s.Address, s.Hours, s.Timezone, s.CashierChatID,
+	), &created)
+	if err != nil {
+		return model.Store{}, storeWriteError(err, "CreateStore INSERT")
+	}
+
+	return created, nil
+}
+
+// UpdateStore перезаписывает данные магазина
+func (r *Repository) UpdateStore(ctx context.Context, s model.Store) (model.Store, error) {
+	var updated model.Store
+	err := scanStore(r.pool.QueryRow(ctx, `
+		UPDATE stores
+		SET name = $2, address = $3, hours = $4, timezone = $5, cashier_chat_id = $6
+		WHERE id = $1
+		RETURNING `+storeColumns,
+		s.ID, s.Name, s.Address, s.Hours, s.Timezone, s.CashierChatID,
+	), &updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Store{}, errs.ErrStoreNotFound
+	}
+	if err != nil {
+		return model.Store{}, storeWriteError(err, "UpdateStore UPDATE")
+	}
+
+	return updated, nil
+}
+
+// SetCatalogStores ограничивает приз каталога списком магазинов. Пустой список снимает ограничение
+func (r *Repository) SetCatalogStores(ctx context.Context, catalogID int64, storeIDs []int64) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("SetCatalogStores begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM prize_catalog WHERE id = $1)`, catalogID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("SetCatalogStores SELECT prize_catalog: %w", err)
+	}
+	if !exists {
+		return errs.ErrCatalogPrizeNotFound
+	}
+
+	var known int
+	err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM stores WHERE id = ANY($1::int[])`, storeIDs).Scan(&known)
+	if err != nil {
+		return fmt.Errorf("SetCatalogStores SELECT stores: %w", err)
+	}
+	if known != len(storeIDs) {
+		return errs.ErrStoreNotFound
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM prize_catalog_stores WHERE catalog_id = $1`, catalogID)
+	if err != nil {
+		return fmt.Errorf("SetCatalogStores DELETE: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO prize_catalog_stores (catalog_id, store_id)
+		SELECT $1, unnest($2::int[])`,
+		catalogID, storeIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("SetCatalogStores INSERT: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("SetCatalogStores commit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/berduk-dev/promocode"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+func normalizePage(limit, offset int) (int, int) {
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	return min(limit, maxPageLimit), max(offset, 0)
+}
+
+// ListPrizes возвращает коды для админки
+func (s *Service) ListPrizes(ctx context.Context, f model.PrizeFilter) ([]model.Prize, int, error) {
+	f.Limit, f.Offset = normalizePage(f.Limit, f.Offset)
+	if f.Code != "" {
+		f.Code = promocode.Normalize(f.Code)
+	}
+
+	prizes, total, err := s.repo.ListPrizes(ctx, f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error repo.ListPrizes: %w", err)
+	}
+
+	return prizes, total, nil
+}
+
+// ListUsers возвращает пользователей бота для админки
+func (s *Service) ListUsers(ctx context.Context, f model.UserFilter) ([]model.User, int, error) {
+	f.Limit, f.Offset = normalizePage(f.Limit, f.Offset)
+
+	users, total, err := s.repo.ListUsers(ctx, f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error repo.ListUsers: %w", err)
+	}
+
+	return users, total, nil
+}
+
+// ListRedemptions возвращает журнал погашений для админки
+func (s *Service) ListRedemptions(ctx context.Context, f model.RedemptionFilter) ([]model.Redemption, int, error) {
+	f.Limit, f.Offset = normalizePage(f.Limit, f.Offset)
+
+	redemptions, total, err := s.repo.ListRedemptions(ctx, f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error repo.ListRedemptions: %w", err)
+	}
+
+	return redemptions, total, nil
+}
+
+// IssuePrize вручную выдает код на конкретный приз каталога без вращения колеса.
+// Лимиты каталога соблюдаются; если акция не указана, берется текущая.
+func (s *Service) IssuePrize(ctx context.Context, catalogID int64, campaignID *int64) (model.Prize, error) {
+	catalogPrize, err := s.repo.GetCatalogPrize(ctx, catalogID)
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("error repo.GetCatalogPrize: %w", err)
+	}
+
+	var campaign model.Campaign
+	if campaignID != nil {
+		campaign, err = s.repo.GetCampaign(ctx, *campaignID)
+	} else {
+		campaign, err = s.repo.GetActiveCampaign(ctx)
+	}
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("error repo.GetCampaign: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		code, err := s.codes.Generate()
+		if err != nil {
+			return model.Prize{}, fmt.Errorf("error codes.Generate: %w", err)
+		}
+
+		err = s.repo.CreatePrize(ctx, model.PrizeIssue{
+			CampaignID:  campaign.ID,
+			CatalogID:   catalogPrize.ID,
+			Prize:       catalogPrize.Name,
+			Code:        code,
+			ClaimTTL:    s.claimTTL,
+			CapTimezone: s.capTimezone,
+		})
+		if errors.Is(err, errs.ErrCodeExists) && attempt < maxCodeAttempts {
+			continue
+		}
+		if err != nil {
+			return model.Prize{}, fmt.Errorf("error repo.CreatePrize: %w", err)
+		}
+
+		prize, err := s.repo.GetPrizeByCode(ctx, code)
+		if err != nil {
+			return model.Prize{}, fmt.Errorf("error repo.GetPrizeByCode: %w", err)
+		}
+		prize.DeepLink = s.DeepLink(prize.Code)
+		return prize, nil
+	}
+}
+
+// VoidPrize аннулирует непогашенный код
+func (s *Service) VoidPrize(ctx context.Context, code string) (model.Prize, error) {
+	prize, err := s.repo.VoidPrize(ctx, promocode.Normalize(code))
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("error repo.VoidPrize: %w", err)
+	}
+
+	return prize, nil
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Максимальный размер одной партии печатных кодов
+const MaxBatchSize = 50000
+
+// CreateBatch генерирует партию из size кодов на приз каталога в указанной акции
+func (s *Service) CreateBatch(ctx context.Context, catalogID, campaignID int64, size int, note string) (model.CodeBatch, error) {
+	if size <= 0 || size > MaxBatchSize {
+		return model.CodeBatch{}, errs.ErrInvalidBatchSize
+	}
+
+	if _, err := s.repo.GetCatalogPrize(ctx, catalogID); err != nil {
+		return model.CodeBatch{}, fmt.Errorf("error repo.GetCatalogPrize: %w", err)
+	}
+	if _, err := s.repo.GetCampaign(ctx, campaignID); err != nil {
+		return model.CodeBatch{}, fmt.Errorf("error repo.GetCampaign: %w", err)
+	}
+
+	codes := make([]string, 0, size)
+	for range size {
+		code, err := s.codes.Generate()
+		if err != nil {
+			return model.CodeBatch{}, fmt.Errorf("error codes.Generate: %w", err)
+		}
+		codes = append(codes, code)
+	}
+
+	batch, err := s.repo.CreateBatch(ctx, model.CodeBatch{
+		CatalogID:  catalogID,
+		CampaignID: campaignID,
+		Size:       size,
+		Note:       note,
+	}, codes, s.codes.Generate)
+	if err != nil {
+		return model.CodeBatch{}, fmt.Errorf("error repo.CreateBatch: %w", err)
+	}
+
+	return batch, nil
+}
+
+// GetBatch возвращает партию по id
+func (s *Service) GetBatch(ctx context.Context, batchID int64) (model.CodeBatch, error) {
+	batch, err := s.repo.GetBatch(ctx, batchID)
+	if err != nil {
+		return model.CodeBatch{}, fmt.Errorf("error repo.GetBatch: %w", err)
+	}
+
+	return batch, nil
+}
+
+// ExportBatchCSV пишет коды партии в CSV для типографии
+func (s *Service) ExportBatchCSV(ctx context.Context, batchID int64, w io.Writer) error {
+	if _, err := s.repo.GetBatch(ctx, batchID); err != nil {
+		return fmt.Errorf("error repo.GetBatch: %w", err)
+	}
+
+	prizes, err := s.repo.ListBatchPrizes(ctx, batchID)
+	if err != nil {
+		return fmt.Errorf("error repo.ListBatchPrizes: %w", err)
+	}
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"batch_id", "code", "deep_link", "prize", "campaign", "expires_at", "status"})
+
+	now := time.Now()
+	for _, p := range prizes {
+		expiresAt := ""
+		if p.ExpiresAt != nil {
+			expiresAt = p.ExpiresAt.Format(time.DateOnly)
+		}
+		_ = cw.Write([]string{
+			strconv.FormatInt(batchID, 10),
+			p.Code,
+			s.DeepLink(p.Code),
+			p.Prize,
+			p.Campaign.Name,
+			expiresAt,
+			p.Status(now),
+		})
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+
+	return nil
+}
+
+// VoidBatch аннулирует все непогашенные коды партии
+func (s *Service) VoidBatch(ctx context.Context, batchID int64) (int64, error) {
+	voided, err := s.repo.VoidBatch(ctx, batchID)
+	if err != nil {
+		return 0, fmt.Errorf("error repo.VoidBatch: %w", err)
+	}
+
+	return voided, nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"strings"
+)
+
+// Проверяет, что окна выдачи и погашения акции не пустые
+func normalizeCampaign(c *model.Campaign) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if !c.IssueStartsAt.Before(c.IssueEndsAt) || !c.RedeemStartsAt.Before(c.RedeemEndsAt) {
+		return errs.ErrInvalidCampaignWindow
+	}
+	return nil
+}
+
+// ListCampaigns возвращает акции для админки
+func (s *Service) ListCampaigns(ctx context.Context) ([]model.Campaign, error) {
+	campaigns, err := s.repo.ListCampaigns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.ListCampaigns: %w", err)
+	}
+
+	return campaigns, nil
+}
+
+// CreateCampaign заводит акцию; выдача кодов начнется, когда наступит ее окно выдачи
+func (s *Service) CreateCampaign(ctx context.Context, c model.Campaign) (model.Campaign, error) {
+	if err := normalizeCampaign(&c); err != nil {
+		return model.Campaign{}, err
+	}
+
+	c, err := s.repo.CreateCampaign(ctx, c)
+	if err != nil {
+		return model.Campaign{}, fmt.Errorf("error repo.CreateCampaign: %w", err)
+	}
+
+	return c, nil
+}
+
+// UpdateCampaign меняет название, адрес и окна акции
+func (s *Service) UpdateCampaign(ctx context.Context, c model.Campaign) (model.Campaign, error) {
+	if err := normalizeCampaign(&c); err != nil {
+		return model.Campaign{}, err
+	}
+
+	c, err := s.repo.UpdateCampaign(ctx, c)
+	if err != nil {
+		return model.Campaign{}, fmt.Errorf("error repo.UpdateCampaign: %w", err)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SpinLimits - лимиты вращений колеса по IP и по cookie клиента (nil - без ограничения)
+type SpinLimits struct {
+	PerIP     *model.RateLimitRule
+	PerClient *model.RateLimitRule
+}
+
+// ParseRateLimit разбирает лимит вида "1/24h" (количество / окно).
+// Пустая строка означает отсутствие лимита.
+func ParseRateLimit(bucket, s string) (*model.RateLimitRule, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	limitStr, windowStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid rate limit %q: expected <count>/<window>", s)
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("invalid rate limit count %q", limitStr)
+	}
+
+	window, err := time.ParseDuration(strings.TrimSpace(windowStr))
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid rate limit window %q", windowStr)
+	}
+
+	return &model.RateLimitRule{
+		Bucket: bucket,
+		Limit:  limit,
+		Window: window,
+	}, nil
+}
+
+// ReserveSpin засчитывает попытку вращения в лимиты по IP и по клиенту
+func (s *Service) ReserveSpin(ctx context.Context, ip, clientID string) (model.RateLimitDecision, error) {
+	var hits []model.RateLimitHit
+	if s.spinLimits.PerIP != nil && ip != "" {
+		hits = append(hits, model.RateLimitHit{Rule: *s.spinLimits.PerIP, Subject: ip})
+	}
+	if s.spinLimits.PerClient != nil && clientID != "" {
+		hits = append(hits, model.RateLimitHit{Rule: *s.spinLimits.PerClient, Subject: clientID})
+	}
+	if len(hits) == 0 {
+		return model.RateLimitDecision{Allowed: true}, nil
+	}
+
+	decision, err := s.repo.ReserveRateLimits(ctx, hits)
+	if err != nil {
+		return model.RateLimitDecision{}, fmt.Errorf("error repo.ReserveRateLimits: %w", err)
+	}
+
+	return decision, nil
+}
+
+// ReleaseSpin возвращает попытку, если вращение не состоялось
+func (s *Service) ReleaseSpin(ctx context.Context, decision model.RateLimitDecision) error {
+	if len(decision.Hits) == 0 {
+		return nil
+	}
+
+	err := s.repo.ReleaseRateLimits(ctx, decision.Hits)
+	if err != nil {
+		return fmt.Errorf("error repo.ReleaseRateLimits: %w", err)
+	}
+
+	return nil
+}
+
+// IsSpinReplay проверяет, что запрос - повтор с ключом идемпотентности, по которому код уже выдан.
+// Такие повторы не должны упираться в лимит.
+func (s *Service) IsSpinReplay(ctx context.Context, sessionID, idempotencyKey string) (bool, error) {
+	if idempotencyKey == "" {
+		return false, nil
+	}
+
+	issued, err := s.repo.GetPrizeByIdempotencyKey(ctx, sessionID, idempotencyKey, s.idempotencyTTL)
+	if err != nil {
+		return false, fmt.Errorf("error repo.GetPrizeByIdempotencyKey: %w", err)
+	}
+
+	return issued != nil, nil
+}
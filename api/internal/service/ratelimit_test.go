@@ -0,0 +1,53 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		wantNil    bool
+		wantLimit  int
+		wantWindow time.Duration
+		wantErr    bool
+	}{
+		{name: "empty means no limit", in: "", wantNil: true},
+		{name: "one per day", in: "1/24h", wantLimit: 1, wantWindow: 24 * time.Hour},
+		{name: "minutes", in: "20/15m", wantLimit: 20, wantWindow: 15 * time.Minute},
+		{name: "spaces", in: " 5 / 1h30m ", wantLimit: 5, wantWindow: 90 * time.Minute},
+		{name: "no separator", in: "5", wantErr: true},
+		{name: "no window unit", in: "5/24", wantErr: true},
+		{name: "zero count", in: "0/1h", wantErr: true},
+		{name: "negative count", in: "-1/1h", wantErr: true},
+		{name: "zero window", in: "5/0s", wantErr: true},
+		{name: "negative window", in: "5/-1h", wantErr: true},
+		{name: "not a number", in: "many/1h", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRateLimit("spin_ip", tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRateLimit(%q) = %+v, want error", tt.in, rule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRateLimit(%q) error = %v", tt.in, err)
+			}
+			if tt.wantNil {
+				if rule != nil {
+					t.Fatalf("ParseRateLimit(%q) = %+v, want nil", tt.in, rule)
+				}
+				return
+			}
+			if rule.Bucket != "spin_ip" || rule.Limit != tt.wantLimit || rule.Window != tt.wantWindow {
+				t.Fatalf("ParseRateLimit(%q) = %+v, want limit %d window %s", tt.in, rule, tt.wantLimit, tt.wantWindow)
+			}
+		})
+	}
+}
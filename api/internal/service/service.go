@@ -3,45 +3,248 @@ package service
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
 	"github.com/berduk-dev/bad-da-yo/internal/repo"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/berduk-dev/promocode"
+	"log"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
 )
 
 type Service struct {
 	repo repo.Repository
+
+	spinSecret     []byte
+	spinTokenTTL   time.Duration
+	idempotencyTTL time.Duration
+	spinLimits     SpinLimits
+	codes          promocode.Generator
+	claimTTL       time.Duration
+	botUsername    string
+	capTimezone    string
+}
+
+// Config - настройки сервиса из окружения
+type Config struct {
+	// Секрет для подписи токенов вращения
+	SpinSecret []byte
+	SpinLimits SpinLimits
+	// Сколько выданный код ждет привязки в Телеграме (0 - до конца погашения акции)
+	ClaimTTL time.Duration
+	// Имя бота для ссылок t.me/<бот>?start=<код>
+	BotUsername string
+	// Часовой пояс (IANA), в котором сбрасываются дневные лимиты призов
+	CapTimezone string
 }
 
-func New(repo repo.Repository) Service {
+// Сколько раз перегенерировать код, если такой уже есть в базе
+const maxCodeAttempts = 5
+
+func New(repo repo.Repository, codes promocode.Generator, cfg Config) Service {
 	return Service{
-		repo: repo,
+		repo:           repo,
+		codes:          codes,
+		spinSecret:     cfg.SpinSecret,
+		spinLimits:     cfg.SpinLimits,
+		claimTTL:       cfg.ClaimTTL,
+		botUsername:    strings.TrimPrefix(cfg.BotUsername, "@"),
+		capTimezone:    cfg.CapTimezone,
+		spinTokenTTL:   5 * time.Minute,
+		idempotencyTTL: 24 * time.Hour,
+	}
+}
+
+// CreatePrize тратит токен вращения, разыгрывает приз из каталога и выдает под него код в текущей акции.
+// Если выпавший приз закончился, розыгрыш повторяется среди оставшихся.
+// Повтор с тем же ключом идемпотентности возвращает ранее выданный код без нового розыгрыша.
+func (s *Service) CreatePrize(ctx context.Context, sessionID, spinToken, idempotencyKey string) (model.Prize, error) {
+	if idempotencyKey != "" {
+		issued, err := s.repo.GetPrizeByIdempotencyKey(ctx, sessionID, idempotencyKey, s.idempotencyTTL)
+		if err != nil {
+			return model.Prize{}, fmt.Errorf("error repo.GetPrizeByIdempotencyKey: %w", err)
+		}
+		if issued != nil {
+			issued.DeepLink = s.DeepLink(issued.Code)
+			return *issued, nil
+		}
+	}
+
+	campaign, err := s.repo.GetActiveCampaign(ctx)
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("error repo.GetActiveCampaign: %w", err)
+	}
+
+	claims, err := s.parseSpinToken(sessionID, spinToken)
+	if err != nil {
+		return model.Prize{}, err
+	}
+
+	catalog, err := s.repo.GetActiveCatalog(ctx, s.capTimezone)
+	if err != nil {
+		return model.Prize{}, fmt.Errorf("error repo.GetActiveCatalog: %w", err)
+	}
+
+	candidates := make([]model.CatalogPrize, 0, len(catalog))
+	for _, p := range catalog {
+		if !p.SoldOut {
+			candidates = append(candidates, p)
+		}
+	}
+
+	codeAttempts := 0
+	for {
+		drawn, err := drawPrize(candidates)
+		if err != nil {
+			return model.Prize{}, err
+		}
+
+		code, err := s.codes.Generate()
+		if err != nil {
+			return model.Prize{}, fmt.Errorf("error codes.Generate: %w", err)
+		}
+
+		err = s.repo.CreatePrize(ctx, model.PrizeIssue{
+			CampaignID:         campaign.ID,
+			CatalogID:          drawn.ID,
+			Prize:              drawn.Name,
+			Code:               code,
+			SessionID:          sessionID,
+			SpinTokenID:        claims.ID,
+			SpinTokenExpiresAt: claims.ExpiresAt.Time,
+			IdempotencyKey:     idempotencyKey,
+			IdempotencyTTL:     s.idempotencyTTL,
+			ClaimTTL:           s.claimTTL,
+			CapTimezone:        s.capTimezone,
+		})
+		if errors.Is(err, errs.ErrPrizeExhausted) {
+			candidates = withoutPrize(candidates, drawn.ID)
+			continue
+		}
+		if errors.Is(err, errs.ErrCodeExists) {
+			codeAttempts++
+			if codeAttempts >= maxCodeAttempts {
+				return model.Prize{}, fmt.Errorf("error repo.CreatePrize after %d attempts: %w", codeAttempts, err)
+			}
+			continue
+		}
+		if errors.Is(err, errs.ErrIdempotencyKeyUsed) {
+			// Параллельный дубль успел выдать код первым - отдаем его
+			issued, lookupErr := s.repo.GetPrizeByIdempotencyKey(ctx, sessionID, idempotencyKey, s.idempotencyTTL)
+			if lookupErr != nil {
+				return model.Prize{}, fmt.Errorf("error repo.GetPrizeByIdempotencyKey: %w", lookupErr)
+			}
+			if issued == nil {
+				return model.Prize{}, err
+			}
+			issued.DeepLink = s.DeepLink(issued.Code)
+			return *issued, nil
+		}
+		if err != nil {
+			return model.Prize{}, fmt.Errorf("error repo.CreatePrize: %w", err)
+		}
+
+		prize, err := s.repo.GetPrizeByCode(ctx, code)
+		if err != nil {
+			return model.Prize{}, fmt.Errorf("error repo.GetPrizeByCode: %w", err)
+		}
+		prize.DeepLink = s.DeepLink(prize.Code)
+		return prize, nil
+	}
+}
+
+// DeepLink возвращает ссылку, открывающую бота с кодом в /start (пусто, если имя бота не задано)
+func (s *Service) DeepLink(code string) string {
+	if s.botUsername == "" {
+		return ""
 	}
+	return "https://t.me/" + s.botUsername + "?start=" + url.QueryEscape(code)
 }
-func (s *Service) CreatePrize(ctx context.Context, prizeName string) (string, error) {
-	code, err := generateCode(6)
 
-	err = s.repo.CreatePrize(ctx, prizeName, code)
+// GetPrizeByCode ищет код так же, как бот на кассе: с нормализацией ввода.
+// Коды текущего формата с неверным контрольным символом в базу не идут.
+func (s *Service) GetPrizeByCode(ctx context.Context, code string) (model.Prize, error) {
+	code = promocode.Normalize(code)
+	if len(code) == s.codes.Len() && !s.codes.Valid(code) {
+		return model.Prize{}, errs.ErrPrizeNotFound
+	}
+
+	prize, err := s.repo.GetPrizeByCode(ctx, code)
 	if err != nil {
-		return "", fmt.Errorf("error repo.CreatePrize: %w", err)
+		return model.Prize{}, fmt.Errorf("error repo.GetPrizeByCode: %w", err)
 	}
+	prize.DeepLink = s.DeepLink(prize.Code)
 
-	return code, nil
+	return prize, nil
 }
 
-// Генерация случайного промокода (буквы + цифры)
-func generateCode(length int) (string, error) {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+// GetCatalog возвращает активные призы для отрисовки колеса
+func (s *Service) GetCatalog(ctx context.Context) ([]model.CatalogPrize, error) {
+	catalog, err := s.repo.GetActiveCatalog(ctx, s.capTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.GetActiveCatalog: %w", err)
+	}
 
-	code := make([]byte, length)
-	randomBytes := make([]byte, length)
+	return catalog, nil
+}
 
-	_, err := rand.Read(randomBytes)
+// Взвешенный случайный выбор приза (crypto/rand, без смещения по модулю)
+func drawPrize(catalog []model.CatalogPrize) (model.CatalogPrize, error) {
+	var total int64
+	for _, p := range catalog {
+		total += int64(p.Weight)
+	}
+	if total <= 0 {
+		return model.CatalogPrize{}, errs.ErrNoPrizesAvailable
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(total))
 	if err != nil {
-		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+		return model.CatalogPrize{}, fmt.Errorf("failed to draw prize: %w", err)
 	}
 
-	for i := range code {
-		code[i] = charset[int(randomBytes[i])%len(charset)]
+	pick := n.Int64()
+	for _, p := range catalog {
+		pick -= int64(p.Weight)
+		if pick < 0 {
+			return p, nil
+		}
+	}
+
+	return model.CatalogPrize{}, errs.ErrNoPrizesAvailable
+}
+
+func withoutPrize(catalog []model.CatalogPrize, id int64) []model.CatalogPrize {
+	out := make([]model.CatalogPrize, 0, len(catalog))
+	for _, p := range catalog {
+		if p.ID != id {
+			out = append(out, p)
+		}
 	}
+	return out
+}
+
+// RunExpirySweeper периодически аннулирует просроченные коды, пока не отменен ctx
+func (s *Service) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-	return string(code), nil
+	for {
+		expired, err := s.repo.ExpireCodes(ctx, s.capTimezone)
+		if err != nil {
+			log.Println("error repo.ExpireCodes:", err)
+		} else if expired > 0 {
+			log.Printf("аннулировано просроченных кодов: %d", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"errors"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"math"
+	"testing"
+)
+
+func TestDrawPrizeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		catalog []model.CatalogPrize
+	}{
+		{name: "empty catalog", catalog: nil},
+		{name: "zero weights", catalog: []model.CatalogPrize{{ID: 1, Weight: 0}, {ID: 2, Weight: 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := drawPrize(tt.catalog)
+			if !errors.Is(err, errs.ErrNoPrizesAvailable) {
+				t.Fatalf("drawPrize() error = %v, want ErrNoPrizesAvailable", err)
+			}
+		})
+	}
+}
+
+func TestDrawPrizeWeights(t *testing.T) {
+	const draws = 20000
+
+	tests := []struct {
+		name    string
+		catalog []model.CatalogPrize
+	}{
+		{name: "single prize", catalog: []model.CatalogPrize{{ID: 1, Weight: 5}}},
+		{name: "equal weights", catalog: []model.CatalogPrize{{ID: 1, Weight: 1}, {ID: 2, Weight: 1}}},
+		{name: "skewed weights", catalog: []model.CatalogPrize{{ID: 1, Weight: 1}, {ID: 2, Weight: 3}, {ID: 3, Weight: 6}}},
+		{name: "zero weight never drawn", catalog: []model.CatalogPrize{{ID: 1, Weight: 0}, {ID: 2, Weight: 2}, {ID: 3, Weight: 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var total int
+			for _, p := range tt.catalog {
+				total += p.Weight
+			}
+
+			counts := make(map[int64]int)
+			for i := 0; i < draws; i++ {
+				p, err := drawPrize(tt.catalog)
+				if err != nil {
+					t.Fatalf("drawPrize: %v", err)
+				}
+				counts[p.ID]++
+			}
+
+			// Доля каждого приза должна быть близка к его доле веса
+			for _, p := range tt.catalog {
+				want := float64(p.Weight) / float64(total)
+				got := float64(counts[p.ID]) / draws
+				if p.Weight == 0 && counts[p.ID] != 0 {
+					t.Fatalf("prize %d with zero weight drawn %d times", p.ID, counts[p.ID])
+				}
+				if math.Abs(got-want) > 0.02 {
+					t.Errorf("prize %d drawn with share %.3f, want %.3f", p.ID, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+// IssueSpinToken выдает подписанный одноразовый токен на одно вращение колеса,
+// привязанный к сессии клиента
+func (s *Service) IssueSpinToken(sessionID string) (string, time.Time, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate token id: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.spinTokenTTL)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ID:        hex.EncodeToString(id),
+		Subject:   sessionID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+
+	signed, err := token.SignedString(s.spinSecret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign spin token: %w", err)
+	}
+
+	return signed, expiresAt, nil
+}
+
+// CheckSpinToken проверяет токен до резервирования попытки в лимитах; потрачен ли он, выяснится при выдаче кода
+func (s *Service) CheckSpinToken(sessionID, token string) error {
+	_, err := s.parseSpinToken(sessionID, token)
+	return err
+}
+
+// Проверяет подпись, срок и сессию токена; тратится токен вместе с выдачей кода
+func (s *Service) parseSpinToken(sessionID, token string) (jwt.RegisteredClaims, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return s.spinSecret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+		jwt.WithSubject(sessionID),
+	)
+	if err != nil {
+		return jwt.RegisteredClaims{}, fmt.Errorf("%w: %w", errs.ErrInvalidSpinToken, err)
+	}
+	if sessionID == "" || claims.ID == "" {
+		return jwt.RegisteredClaims{}, errs.ErrInvalidSpinToken
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"testing"
+	"time"
+)
+
+func TestParseSpinToken(t *testing.T) {
+	s := &Service{spinSecret: []byte("secret"), spinTokenTTL: time.Minute}
+	other := &Service{spinSecret: []byte("other secret"), spinTokenTTL: time.Minute}
+	expired := &Service{spinSecret: []byte("secret"), spinTokenTTL: -time.Minute}
+
+	issue := func(s *Service, sessionID string) string {
+		t.Helper()
+		token, _, err := s.IssueSpinToken(sessionID)
+		if err != nil {
+			t.Fatalf("IssueSpinToken: %v", err)
+		}
+		return token
+	}
+
+	valid := issue(s, "session")
+
+	tests := []struct {
+		name      string
+		sessionID string
+		token     string
+		wantErr   bool
+	}{
+		{name: "valid", sessionID: "session", token: valid},
+		{name: "other session", sessionID: "another", token: valid, wantErr: true},
+		{name: "no session", sessionID: "", token: issue(s, ""), wantErr: true},
+		{name: "expired", sessionID: "session", token: issue(expired, "session"), wantErr: true},
+		{name: "foreign secret", sessionID: "session", token: issue(other, "session"), wantErr: true},
+		{name: "tampered", sessionID: "session", token: valid[:len(valid)-2] + "xx", wantErr: true},
+		{name: "empty", sessionID: "session", token: "", wantErr: true},
+		{name: "garbage", sessionID: "session", token: "not.a.token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.parseSpinToken(tt.sessionID, tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, errs.ErrInvalidSpinToken) {
+					t.Fatalf("parseSpinToken() error = %v, want ErrInvalidSpinToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSpinToken() error = %v", err)
+			}
+			if claims.ID == "" || claims.Subject != tt.sessionID {
+				t.Fatalf("parseSpinToken() claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestIssueSpinTokenUnique(t *testing.T) {
+	s := &Service{spinSecret: []byte("secret"), spinTokenTTL: time.Minute}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, expiresAt, err := s.IssueSpinToken("session")
+		if err != nil {
+			t.Fatalf("IssueSpinToken: %v", err)
+		}
+		if until := time.Until(expiresAt); until <= 0 || until > time.Minute {
+			t.Fatalf("IssueSpinToken() expires in %s, want within %s", until, time.Minute)
+		}
+
+		claims, err := s.parseSpinToken("session", token)
+		if err != nil {
+			t.Fatalf("parseSpinToken: %v", err)
+		}
+		if seen[claims.ID] {
+			t.Fatalf("token id %q issued twice", claims.ID)
+		}
+		seen[claims.ID] = true
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/berduk-dev/bad-da-yo/internal/model"
+	"github.com/berduk-dev/bad-da-yo/internal/repo/errs"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultStoreTimezone = "Europe/Moscow"
+
+// Проверяет часовой пояс магазина, пустой заменяет на московский
+func normalizeStore(s *model.Store) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Timezone == "" {
+		s.Timezone = defaultStoreTimezone
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return errs.ErrInvalidTimezone
+	}
+	return nil
+}
+
+// ListStores возвращает магазины для админки
+func (s *Service) ListStores(ctx context.Context) ([]model.Store, error) {
+	stores, err := s.repo.ListStores(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.ListStores: %w", err)
+	}
+
+	return stores, nil
+}
+
+// CreateStore добавляет магазин
+func (s *Service) CreateStore(ctx context.Context, store model.Store) (model.Store, error) {
+	if err := normalizeStore(&store); err != nil {
+		return model.Store{}, err
+	}
+
+	store, err := s.repo.CreateStore(ctx, store)
+	if err != nil {
+		return model.Store{}, fmt.Errorf("error repo.CreateStore: %w", err)
+	}
+
+	return store, nil
+}
+
+// UpdateStore меняет данные магазина, в том числе чат кассиров
+func (s *Service) UpdateStore(ctx context.Context, store model.Store) (model.Store, error) {
+	if err := normalizeStore(&store); err != nil {
+		return model.Store{}, err
+	}
+
+	store, err := s.repo.UpdateStore(ctx, store)
+	if err != nil {
+		return model.Store{}, fmt.Errorf("error repo.UpdateStore: %w", err)
+	}
+
+	return store, nil
+}
+
+// SetCatalogStores задает магазины, в которых можно получить приз каталога, и возвращает их без повторов
+func (s *Service) SetCatalogStores(ctx context.Context, catalogID int64, storeIDs []int64) ([]int64, error) {
+	storeIDs = slices.Clone(storeIDs)
+	slices.Sort(storeIDs)
+	storeIDs = slices.Compact(storeIDs)
+	if storeIDs == nil {
+		storeIDs = []int64{}
+	}
+
+	err := s.repo.SetCatalogStores(ctx, catalogID, storeIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.SetCatalogStores: %w", err)
+	}
+
+	return storeIDs, nil
+}
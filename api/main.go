@@ -4,11 +4,15 @@ import (
 	"context"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/berduk-dev/bad-da-yo/internal/handler"
 	"github.com/berduk-dev/bad-da-yo/internal/repo"
 	"github.com/berduk-dev/bad-da-yo/internal/service"
+	"github.com/berduk-dev/promocode"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -30,23 +34,139 @@ func main() {
 		log.Fatal("Ошибка ping:", err)
 	}
 
-	r := gin.Default()
+	// Алфавит и длина промокодов, общие с ботом
+	codeLength, err := strconv.Atoi(envOrDefault("CODE_LENGTH", strconv.Itoa(promocode.DefaultLength)))
+	if err != nil {
+		log.Fatal("Ошибка CODE_LENGTH:", err)
+	}
+	codes, err := promocode.New(envOrDefault("CODE_ALPHABET", promocode.DefaultAlphabet), codeLength)
+	if err != nil {
+		log.Fatal("Ошибка настройки промокодов:", err)
+	}
 
 	bdyRepository := repo.New(pool)
-	bdyService := service.New(bdyRepository)
+
+	// CLI для партий печатных кодов: ./server batch ...
+	if len(os.Args) > 1 && os.Args[1] == "batch" {
+		cliService := service.New(bdyRepository, codes, service.Config{
+			BotUsername: os.Getenv("TELEGRAM_BOT_USERNAME"),
+		})
+		if err := runBatchCommand(ctx, &cliService, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	r := gin.Default()
+
+	// X-Forwarded-For принимаем только от своих прокси (адреса или CIDR через запятую),
+	// иначе клиент подменит IP и обойдет лимит вращений. Без списка берется адрес соединения
+	if err := r.SetTrustedProxies(splitList(os.Getenv("TRUSTED_PROXIES"))); err != nil {
+		log.Fatal("Ошибка TRUSTED_PROXIES:", err)
+	}
+
+	// Секрет для подписи токенов вращения колеса
+	spinSecret := os.Getenv("SPIN_TOKEN_SECRET")
+	if spinSecret == "" {
+		log.Fatal("SPIN_TOKEN_SECRET не задан")
+	}
+
+	// Лимиты вращений в формате "<количество>/<окно>", например "1/24h"
+	perIPLimit, err := service.ParseRateLimit("spin_ip", envOrDefault("SPIN_LIMIT_PER_IP", "20/24h"))
+	if err != nil {
+		log.Fatal("Ошибка SPIN_LIMIT_PER_IP:", err)
+	}
+	perClientLimit, err := service.ParseRateLimit("spin_client", envOrDefault("SPIN_LIMIT_PER_CLIENT", "1/24h"))
+	if err != nil {
+		log.Fatal("Ошибка SPIN_LIMIT_PER_CLIENT:", err)
+	}
+
+	// Срок на привязку кода в Телеграме и интервал аннулирования просроченных кодов
+	claimTTL, err := time.ParseDuration(envOrDefault("CODE_CLAIM_TTL", "0s"))
+	if err != nil {
+		log.Fatal("Ошибка CODE_CLAIM_TTL:", err)
+	}
+	sweepInterval, err := time.ParseDuration(envOrDefault("CODE_SWEEP_INTERVAL", "5m"))
+	if err != nil || sweepInterval <= 0 {
+		log.Fatal("Ошибка CODE_SWEEP_INTERVAL:", err)
+	}
+
+	// Часовой пояс, в котором сбрасываются дневные лимиты призов; общий с ботом
+	timezone := envOrDefault("TIMEZONE", "Europe/Moscow")
+	if _, err := time.LoadLocation(timezone); err != nil {
+		log.Fatal("Ошибка TIMEZONE:", err)
+	}
+
+	bdyService := service.New(bdyRepository, codes, service.Config{
+		SpinSecret: []byte(spinSecret),
+		SpinLimits: service.SpinLimits{
+			PerIP:     perIPLimit,
+			PerClient: perClientLimit,
+		},
+		ClaimTTL:    claimTTL,
+		BotUsername: os.Getenv("TELEGRAM_BOT_USERNAME"),
+		CapTimezone: timezone,
+	})
 	bdyHandler := handler.New(bdyService)
 
+	go bdyService.RunExpirySweeper(ctx, sweepInterval)
+
 	// CORS middleware
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{os.Getenv("FRONTEND_URL")}, // разрешённые домены
-		AllowMethods:     []string{"GET", "POST"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Spin-Token", "Idempotency-Key", "X-API-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	r.POST("/prize", bdyHandler.CreatePrize) // получить приз + отправить код
+	r.GET("/prizes", bdyHandler.GetPrizes)                         // секторы колеса
+	r.GET("/spin-token", bdyHandler.GetSpinToken)                  // одноразовый токен на вращение
+	r.POST("/prize", bdyHandler.SpinLimit, bdyHandler.CreatePrize) // розыгрыш приза на сервере + код
+	r.GET("/prize/:code", bdyHandler.GetPrizeStatus)               // статус кода для лендинга
+	r.GET("/prize/:code/qr.png", bdyHandler.GetPrizeQRPNG)         // QR со ссылкой на бота
+	r.GET("/prize/:code/qr.svg", bdyHandler.GetPrizeQRSVG)
+
+	// Админское API для внутренних инструментов; ключи через запятую в ADMIN_API_KEYS
+	if adminKeys := splitList(os.Getenv("ADMIN_API_KEYS")); len(adminKeys) > 0 {
+		admin := r.Group("/admin", handler.AdminAuth(adminKeys))
+		admin.GET("/prizes", bdyHandler.AdminListPrizes)
+		admin.POST("/prizes", bdyHandler.AdminIssuePrize)
+		admin.POST("/prizes/:code/void", bdyHandler.AdminVoidPrize)
+		admin.GET("/users", bdyHandler.AdminListUsers)
+		admin.GET("/redemptions", bdyHandler.AdminListRedemptions)
+		admin.POST("/batches", bdyHandler.AdminCreateBatch)
+		admin.GET("/batches/:id", bdyHandler.AdminGetBatch)
+		admin.GET("/batches/:id/codes.csv", bdyHandler.AdminExportBatch)
+		admin.POST("/batches/:id/void", bdyHandler.AdminVoidBatch)
+		admin.GET("/stores", bdyHandler.AdminListStores)
+		admin.POST("/stores", bdyHandler.AdminCreateStore)
+		admin.PUT("/stores/:id", bdyHandler.AdminUpdateStore)
+		admin.PUT("/catalog/:id/stores", bdyHandler.AdminSetCatalogStores)
+		admin.GET("/campaigns", bdyHandler.AdminListCampaigns)
+		admin.POST("/campaigns", bdyHandler.AdminCreateCampaign)
+		admin.PUT("/campaigns/:id", bdyHandler.AdminUpdateCampaign)
+	} else {
+		log.Println("ADMIN_API_KEYS не задан, админское API отключено")
+	}
 
 	_ = r.Run(":8080")
 }
+
+func envOrDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,3 @@
+module github.com/berduk-dev/promocode
+
+go 1.23.0
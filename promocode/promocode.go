@@ -0,0 +1,133 @@
+// Package promocode генерирует и проверяет промокоды колеса.
+// Общий для API и бота: API выдает коды, бот проверяет их на кассе.
+package promocode
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// DefaultAlphabet - алфавит без похожих символов (нет 0/O, 1/I/L)
+const DefaultAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// DefaultLength - длина кода без контрольного символа
+const DefaultLength = 6
+
+var ErrInvalidConfig = errors.New("invalid promocode config")
+
+// Generator выдает коды заданной длины из алфавита и добавляет к ним контрольный символ
+type Generator struct {
+	alphabet string
+	length   int
+	index    map[rune]int
+}
+
+func New(alphabet string, length int) (Generator, error) {
+	if length <= 0 {
+		return Generator{}, fmt.Errorf("%w: length must be positive", ErrInvalidConfig)
+	}
+	if len(alphabet) < 2 {
+		return Generator{}, fmt.Errorf("%w: alphabet is too short", ErrInvalidConfig)
+	}
+
+	index := make(map[rune]int, len(alphabet))
+	for i, r := range alphabet {
+		if r > unicode.MaxASCII || r != unicode.ToUpper(r) {
+			return Generator{}, fmt.Errorf("%w: alphabet must be upper-case ASCII", ErrInvalidConfig)
+		}
+		if _, ok := index[r]; ok {
+			return Generator{}, fmt.Errorf("%w: duplicate symbol %q in alphabet", ErrInvalidConfig, r)
+		}
+		index[r] = i
+	}
+
+	return Generator{
+		alphabet: alphabet,
+		length:   length,
+		index:    index,
+	}, nil
+}
+
+// Default - генератор с алфавитом и длиной по умолчанию
+func Default() Generator {
+	g, _ := New(DefaultAlphabet, DefaultLength)
+	return g
+}
+
+// Len - полная длина кода вместе с контрольным символом
+func (g Generator) Len() int {
+	return g.length + 1
+}
+
+// Generate возвращает случайный код (crypto/rand, без смещения по модулю)
+func (g Generator) Generate() (string, error) {
+	n := big.NewInt(int64(len(g.alphabet)))
+
+	code := make([]byte, g.length, g.length+1)
+	for i := range code {
+		k, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate code: %w", err)
+		}
+		code[i] = g.alphabet[k.Int64()]
+	}
+
+	return string(append(code, g.checkChar(string(code)))), nil
+}
+
+// Valid проверяет длину, алфавит и контрольный символ уже нормализованного кода
+func (g Generator) Valid(code string) bool {
+	if len(code) != g.Len() {
+		return false
+	}
+	for _, r := range code {
+		if _, ok := g.index[r]; !ok {
+			return false
+		}
+	}
+
+	return g.checkChar(code[:g.length]) == code[g.length]
+}
+
+// Контрольный символ - взвешенная по позициям сумма по модулю размера алфавита.
+// Перестановку соседних символов ловит всегда, а любую одиночную опечатку -
+// если размер алфавита простой (в алфавите по умолчанию 31 символ)
+func (g Generator) checkChar(payload string) byte {
+	base := len(g.alphabet)
+	sum := 0
+	for i := 0; i < len(payload); i++ {
+		sum += (i + 1) * g.index[rune(payload[i])]
+	}
+
+	return g.alphabet[(base-sum%base)%base]
+}
+
+// Normalize приводит введенный код к виду, в котором он хранится:
+// верхний регистр, без пробелов и дефисов, кириллические двойники заменены латиницей
+func Normalize(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		if rr, ok := lookalikes[r]; ok {
+			out = append(out, rr)
+			continue
+		}
+		// выбросим пробелы, дефисы и невидимые символы (ZWSP и т.п.)
+		if unicode.IsSpace(r) || r == '-' || unicode.Is(unicode.Cf, r) {
+			continue
+		}
+		out = append(out, r)
+	}
+
+	return string(out)
+}
+
+// Кириллические буквы, которые в Телеграме легко спутать с латинскими
+var lookalikes = map[rune]rune{
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T', 'У': 'Y', 'Х': 'X',
+}
@@ -0,0 +1,198 @@
+package promocode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		length   int
+		wantErr  bool
+	}{
+		{name: "default", alphabet: DefaultAlphabet, length: DefaultLength},
+		{name: "zero length", alphabet: DefaultAlphabet, length: 0, wantErr: true},
+		{name: "short alphabet", alphabet: "A", length: 6, wantErr: true},
+		{name: "lower case", alphabet: "abc", length: 6, wantErr: true},
+		{name: "non ascii", alphabet: "ABЖ", length: 6, wantErr: true},
+		{name: "duplicate symbol", alphabet: "ABCA", length: 6, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.alphabet, tt.length)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("New(%q, %d) error = %v, wantErr %v", tt.alphabet, tt.length, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("New(%q, %d) error = %v, want ErrInvalidConfig", tt.alphabet, tt.length, err)
+			}
+		})
+	}
+}
+
+func TestGenerateValidRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		length   int
+	}{
+		{name: "default", alphabet: DefaultAlphabet, length: DefaultLength},
+		{name: "short code", alphabet: DefaultAlphabet, length: 3},
+		{name: "long code", alphabet: DefaultAlphabet, length: 12},
+		{name: "small prime alphabet", alphabet: "ABCDEFG", length: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New(tt.alphabet, tt.length)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			for i := 0; i < 200; i++ {
+				code, err := g.Generate()
+				if err != nil {
+					t.Fatalf("Generate: %v", err)
+				}
+				if len(code) != g.Len() {
+					t.Fatalf("Generate() = %q, len %d, want %d", code, len(code), g.Len())
+				}
+				if !g.Valid(code) {
+					t.Fatalf("Valid(%q) = false for a generated code", code)
+				}
+				if got := Normalize(code); got != code {
+					t.Fatalf("Normalize(%q) = %q, generated codes must already be normalized", code, got)
+				}
+			}
+		})
+	}
+}
+
+func TestValidRejectsTypos(t *testing.T) {
+	g := Default()
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{name: "distinct symbols", payload: "A2B3C4"},
+		{name: "repeated symbols", payload: "ZZZZZ2"},
+		{name: "edges of alphabet", payload: "2Z2Z2Z"},
+		{name: "mixed", payload: "HJ7KQ9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := tt.payload + string(g.checkChar(tt.payload))
+			if !g.Valid(code) {
+				t.Fatalf("Valid(%q) = false", code)
+			}
+
+			// Любая замена одного символа, включая контрольный
+			for i := 0; i < len(code); i++ {
+				for j := 0; j < len(DefaultAlphabet); j++ {
+					if DefaultAlphabet[j] == code[i] {
+						continue
+					}
+					typo := code[:i] + string(DefaultAlphabet[j]) + code[i+1:]
+					if g.Valid(typo) {
+						t.Errorf("Valid(%q) = true, typo at position %d of %q", typo, i, code)
+					}
+				}
+			}
+
+			// Перестановка соседних различных символов кода
+			for i := 0; i+1 < len(tt.payload); i++ {
+				if code[i] == code[i+1] {
+					continue
+				}
+				swapped := code[:i] + string(code[i+1]) + string(code[i]) + code[i+2:]
+				if g.Valid(swapped) {
+					t.Errorf("Valid(%q) = true, swap at positions %d,%d of %q", swapped, i, i+1, code)
+				}
+			}
+		})
+	}
+}
+
+func TestValidRejectsMalformed(t *testing.T) {
+	g := Default()
+	code := "A2B3C4" + string(g.checkChar("A2B3C4"))
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{name: "empty", code: ""},
+		{name: "too short", code: code[:len(code)-1]},
+		{name: "too long", code: code + "A"},
+		{name: "lower case", code: "a2b3c4" + code[len(code)-1:]},
+		{name: "symbol outside alphabet", code: "A0B3C4" + code[len(code)-1:]},
+		{name: "not normalized", code: "A2B-3C4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if g.Valid(tt.code) {
+				t.Fatalf("Valid(%q) = true", tt.code)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "already normalized", in: "A2B3C4D", want: "A2B3C4D"},
+		{name: "lower case", in: "a2b3c4d", want: "A2B3C4D"},
+		{name: "surrounding spaces", in: "  A2B3C4D\n", want: "A2B3C4D"},
+		{name: "inner spaces and dashes", in: "A2B-3C4 D", want: "A2B3C4D"},
+		{name: "tab and non-breaking space", in: "A2B\t3C4\u00a0D", want: "A2B3C4D"},
+		{name: "zero width space", in: "A2B\u200b3C4D", want: "A2B3C4D"},
+		{name: "cyrillic upper case", in: "АВЕКМНОРСТУХ", want: "ABEKMHOPCTYX"},
+		{name: "cyrillic lower case", in: "авекмнорстух", want: "ABEKMHOPCTYX"},
+		{name: "mixed cyrillic and latin", in: "К2М-3Р4с", want: "K2M3P4C"},
+		{name: "cyrillic without lookalike kept", in: "Ж2", want: "Ж2"},
+		{name: "digits kept", in: "0123456789", want: "0123456789"},
+		{name: "empty", in: "", want: ""},
+		{name: "only separators", in: " - \t", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Fatalf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeThenValid(t *testing.T) {
+	g := Default()
+	payload := "K2M3P4"
+	code := payload + string(g.checkChar(payload))
+
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{name: "as issued", in: code},
+		{name: "lower case with dash", in: "k2m-3p4" + code[len(code)-1:]},
+		{name: "cyrillic lookalikes", in: "К2М3Р4" + code[len(code)-1:]},
+		{name: "spaced", in: " K2M 3P4 " + code[len(code)-1:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !g.Valid(Normalize(tt.in)) {
+				t.Fatalf("Valid(Normalize(%q)) = false", tt.in)
+			}
+		})
+	}
+}
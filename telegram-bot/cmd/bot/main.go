@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/berduk-dev/promocode"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"tgbot-bad-da-yo/internal/handler"
 	"tgbot-bad-da-yo/internal/repo"
 	"tgbot-bad-da-yo/internal/service"
+	"tgbot-bad-da-yo/model"
+	"time"
+	_ "time/tzdata"
 )
 
 func main() {
@@ -47,13 +53,152 @@ func main() {
 
 	bot.Debug = true
 
-	adminID, _ := strconv.ParseInt(os.Getenv("ADMIN_ID"), 10, 64)
-	developerID, _ := strconv.ParseInt(os.Getenv("DEVELOPER_TG_ID"), 10, 64)
-	adminChatID, _ := strconv.ParseInt(os.Getenv("ADMIN_TELEGRAM_CHAT_ID"), 10, 64)
+	adminID := envInt64("ADMIN_ID")
+	developerID := envInt64("DEVELOPER_TG_ID")
+	adminChatID := envInt64("ADMIN_TELEGRAM_CHAT_ID")
+
+	// Алфавит и длина промокодов должны совпадать с API
+	codeLength := promocode.DefaultLength
+	if v := os.Getenv("CODE_LENGTH"); v != "" {
+		codeLength, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal("Ошибка CODE_LENGTH:", err)
+		}
+	}
+	codeAlphabet := os.Getenv("CODE_ALPHABET")
+	if codeAlphabet == "" {
+		codeAlphabet = promocode.DefaultAlphabet
+	}
+	codes, err := promocode.New(codeAlphabet, codeLength)
+	if err != nil {
+		log.Fatal("Ошибка настройки промокодов:", err)
+	}
+
+	// Срок на погашение после привязки кода (0 - до конца акции)
+	var redeemTTL time.Duration
+	if v := os.Getenv("CODE_REDEEM_TTL"); v != "" {
+		redeemTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Ошибка CODE_REDEEM_TTL:", err)
+		}
+	}
+
+	// Часовой пояс для времени в сообщениях бота. В базе время хранится в UTC
+	timezone := os.Getenv("TIMEZONE")
+	if timezone == "" {
+		timezone = "Europe/Moscow"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Fatal("Ошибка TIMEZONE:", err)
+	}
 
 	r := repo.New(pool)
-	s := service.New(r, bot)
-	h := handler.New(bot, s, adminID, developerID, adminChatID)
+	s := service.New(r, bot, codes, redeemTTL)
+
+	// Чаты кассиров теперь у магазинов; прежний общий чат достается первому магазину
+	if adminChatID != 0 {
+		bound, err := s.BindLegacyCashierChat(ctx, adminChatID)
+		if err != nil {
+			log.Fatal("Ошибка привязки чата кассиров:", err)
+		}
+		if bound {
+			fmt.Println("🏪 Чат кассиров из ADMIN_TELEGRAM_CHAT_ID привязан к первому магазину.")
+		}
+	}
+
+	// Роли хранятся в базе; владелец и разработчик из окружения нужны для первого входа,
+	// остальных добавляют командой /staff
+	if adminID != 0 {
+		if err := s.EnsureStaff(ctx, adminID, model.RoleOwner); err != nil {
+			log.Fatal("Ошибка добавления владельца:", err)
+		}
+	}
+	if developerID != 0 {
+		if err := s.EnsureStaff(ctx, developerID, model.RoleDeveloper); err != nil {
+			log.Fatal("Ошибка добавления разработчика:", err)
+		}
+	}
+
+	// Останавливаемся по сигналу, дав доработать принятым апдейтам и рассылке
+	runCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	h.Start()
+	// Брошенные диалоги просрочены и так, фоновая очистка только не дает таблице расти
+	go s.RunConversationCleanup(runCtx, time.Hour)
+
+	// Рассылки уходят в фоне; незавершенные продолжаются после перезапуска
+	mailingsDone := make(chan struct{})
+	go func() {
+		s.RunMailings(runCtx, time.Minute)
+		close(mailingsDone)
+	}()
+
+	// Параллельная обработка апдейтов: разные чаты - одновременно, один чат - по порядку
+	workers := 8
+	if v := os.Getenv("BOT_WORKERS"); v != "" {
+		workers, err = strconv.Atoi(v)
+		if err != nil || workers < 1 {
+			log.Fatal("Ошибка BOT_WORKERS:", v)
+		}
+	}
+	updateTimeout := 30 * time.Second
+	if v := os.Getenv("BOT_UPDATE_TIMEOUT"); v != "" {
+		updateTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal("Ошибка BOT_UPDATE_TIMEOUT:", err)
+		}
+	}
+
+	h := handler.New(bot, s, handler.Config{
+		Location:      location,
+		Workers:       workers,
+		UpdateTimeout: updateTimeout,
+	})
+
+	// Режим получения апдейтов: long polling (по умолчанию) или вебхук за reverse proxy
+	switch mode := os.Getenv("BOT_MODE"); mode {
+	case "", "polling":
+		err = h.Start(runCtx)
+	case "webhook":
+		listen := os.Getenv("WEBHOOK_LISTEN")
+		if listen == "" {
+			listen = ":8081"
+		}
+		deleteOnShutdown := false
+		if v := os.Getenv("WEBHOOK_DELETE_ON_SHUTDOWN"); v != "" {
+			deleteOnShutdown, err = strconv.ParseBool(v)
+			if err != nil {
+				log.Fatal("Ошибка WEBHOOK_DELETE_ON_SHUTDOWN:", v)
+			}
+		}
+		err = h.StartWebhook(runCtx, handler.WebhookConfig{
+			URL:              os.Getenv("WEBHOOK_URL"),
+			Listen:           listen,
+			Secret:           os.Getenv("WEBHOOK_SECRET"),
+			DeleteOnShutdown: deleteOnShutdown,
+		})
+	default:
+		log.Fatal("Ошибка BOT_MODE, нужен polling или webhook:", mode)
+	}
+	if err != nil {
+		log.Fatal("Ошибка работы бота:", err)
+	}
+
+	stop()
+	<-mailingsDone
+}
+
+// Необязательный числовой ID из окружения: пустое значение - 0, некорректное - ошибка запуска
+func envInt64(key string) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return 0
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		log.Fatalf("Ошибка %s: %v", key, err)
+	}
+	return n
 }
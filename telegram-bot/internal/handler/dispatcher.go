@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// dispatcher раздает апдейты ограниченному числу воркеров. Апдейты одного чата
+// обрабатываются строго по очереди, разные чаты - параллельно
+type dispatcher struct {
+	handle  func(ctx context.Context, update tgbotapi.Update)
+	timeout time.Duration
+
+	// Свободные места в пуле; когда все заняты, Dispatch ждет
+	slots chan struct{}
+
+	mu     sync.Mutex
+	queues map[int64][]tgbotapi.Update
+
+	wg sync.WaitGroup
+}
+
+func newDispatcher(workers int, timeout time.Duration, handle func(ctx context.Context, update tgbotapi.Update)) *dispatcher {
+	return &dispatcher{
+		handle:  handle,
+		timeout: timeout,
+		slots:   make(chan struct{}, max(workers, 1)),
+		queues:  make(map[int64][]tgbotapi.Update),
+	}
+}
+
+// Dispatch ставит апдейт в очередь его чата и, если чат еще никто не обрабатывает, занимает под него воркер
+func (d *dispatcher) Dispatch(update tgbotapi.Update) {
+	key := updateChatID(update)
+
+	d.mu.Lock()
+	queue, busy := d.queues[key]
+	d.queues[key] = append(queue, update)
+	d.mu.Unlock()
+
+	if busy {
+		return
+	}
+
+	d.slots <- struct{}{}
+	d.wg.Add(1)
+	go d.drain(key)
+}
+
+// Wait дожидается обработки всех принятых апдейтов
+func (d *dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// Обрабатывает очередь чата, пока она не опустеет
+func (d *dispatcher) drain(key int64) {
+	defer d.wg.Done()
+	defer func() { <-d.slots }()
+
+	for {
+		d.mu.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		update := queue[0]
+		d.queues[key] = queue[1:]
+		d.mu.Unlock()
+
+		d.process(update)
+	}
+}
+
+// У каждого апдейта свой контекст с таймаутом; паника в обработчике не роняет бота
+func (d *dispatcher) process(update tgbotapi.Update) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic while handling update %d: %v\n%s", update.UpdateID, r, debug.Stack())
+		}
+	}()
+
+	d.handle(ctx, update)
+}
+
+// Чат, в рамках которого важен порядок апдейтов
+func updateChatID(update tgbotapi.Update) int64 {
+	if chat := update.FromChat(); chat != nil {
+		return chat.ID
+	}
+	if user := update.SentFrom(); user != nil {
+		return user.ID
+	}
+	return 0
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func chatUpdate(id int, chatID int64) tgbotapi.Update {
+	return tgbotapi.Update{
+		UpdateID: id,
+		Message:  &tgbotapi.Message{Chat: &tgbotapi.Chat{ID: chatID}},
+	}
+}
+
+func TestDispatcherPerChatOrder(t *testing.T) {
+	const (
+		chats   = 5
+		perChat = 40
+	)
+
+	tests := []struct {
+		name    string
+		workers int
+	}{
+		{name: "single worker", workers: 1},
+		{name: "fewer workers than chats", workers: 2},
+		{name: "more workers than chats", workers: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu         sync.Mutex
+				seen       = make(map[int64][]int)
+				inChat     = make(map[int64]int)
+				running    atomic.Int32
+				maxRunning atomic.Int32
+			)
+
+			d := newDispatcher(tt.workers, time.Second, func(ctx context.Context, update tgbotapi.Update) {
+				chatID := update.Message.Chat.ID
+
+				n := running.Add(1)
+				defer running.Add(-1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+
+				mu.Lock()
+				inChat[chatID]++
+				if inChat[chatID] > 1 {
+					t.Errorf("chat %d handled concurrently", chatID)
+				}
+				mu.Unlock()
+
+				// Даем другим апдейтам шанс обогнать этот, если порядок не соблюдается
+				time.Sleep(time.Duration(update.UpdateID%3) * 100 * time.Microsecond)
+
+				mu.Lock()
+				inChat[chatID]--
+				seen[chatID] = append(seen[chatID], update.UpdateID)
+				mu.Unlock()
+			})
+
+			// Апдейты разных чатов идут вперемешку, как из Telegram
+			id := 0
+			for i := 0; i < perChat; i++ {
+				for chat := int64(1); chat <= chats; chat++ {
+					id++
+					d.Dispatch(chatUpdate(id, chat))
+				}
+			}
+			d.Wait()
+
+			for chat := int64(1); chat <= chats; chat++ {
+				ids := seen[chat]
+				if len(ids) != perChat {
+					t.Fatalf("chat %d: handled %d updates, want %d", chat, len(ids), perChat)
+				}
+				for i := 1; i < len(ids); i++ {
+					if ids[i] <= ids[i-1] {
+						t.Fatalf("chat %d: update %d handled after %d", chat, ids[i], ids[i-1])
+					}
+				}
+			}
+			if got := int(maxRunning.Load()); got > tt.workers {
+				t.Fatalf("%d updates handled at once, want at most %d", got, tt.workers)
+			}
+		})
+	}
+}
+
+func TestDispatcherTimeoutAndPanic(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+
+	var (
+		mu        sync.Mutex
+		handled   []int
+		deadlines []time.Duration
+	)
+
+	d := newDispatcher(2, timeout, func(ctx context.Context, update tgbotapi.Update) {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			t.Errorf("update %d: context without deadline", update.UpdateID)
+		}
+
+		mu.Lock()
+		handled = append(handled, update.UpdateID)
+		deadlines = append(deadlines, time.Until(deadline))
+		mu.Unlock()
+
+		if update.UpdateID == 1 {
+			panic("handler failure")
+		}
+	})
+
+	// Паника в первом апдейте не должна остановить очередь чата
+	d.Dispatch(chatUpdate(1, 10))
+	d.Dispatch(chatUpdate(2, 10))
+	d.Wait()
+
+	if len(handled) != 2 || handled[0] != 1 || handled[1] != 2 {
+		t.Fatalf("handled updates %v, want [1 2]", handled)
+	}
+	for i, left := range deadlines {
+		if left <= 0 || left > timeout {
+			t.Fatalf("update %d: deadline in %s, want within %s", handled[i], left, timeout)
+		}
+	}
+}
@@ -8,19 +8,13 @@ import (
 	"strings"
 	"tgbot-bad-da-yo/internal/repo/errs"
 	"tgbot-bad-da-yo/internal/service"
+	"tgbot-bad-da-yo/model"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/jackc/pgx/v5"
 )
 
-type adminState string
-
-const (
-	StateIdle             adminState = "idle"
-	StateComposingMailing adminState = "composing_text"
-	StateConfirmMailing   adminState = "confirm_mailing"
-)
-
 type mediaType string
 
 const (
@@ -35,51 +29,81 @@ type Handler struct {
 	service service.Service
 	bot     *tgbotapi.BotAPI
 
-	adminID     int64
-	developerID int64
-	adminChatID int64
+	// Часовой пояс для сообщений пользователям; в чатах кассиров - пояс магазина
+	location *time.Location
 
-	mailText    string
-	mailMediaID string
-	mailMedia   mediaType
-	adminState  adminState
+	workers       int
+	updateTimeout time.Duration
+}
 
-	// Хранилище кодов призов для пользователей, ожидающих отправки номера
-	userPrizeCodes map[int64]string
+// Config - настройки обработчика из окружения
+type Config struct {
+	Location *time.Location
+	// Сколько апдейтов разных чатов обрабатываются одновременно
+	Workers int
+	// Сколько времени дается на обработку одного апдейта
+	UpdateTimeout time.Duration
 }
 
-func New(bot *tgbotapi.BotAPI, service service.Service, adminID, developerID, adminChatID int64) Handler {
+func New(bot *tgbotapi.BotAPI, service service.Service, cfg Config) Handler {
 	return Handler{
-		service:        service,
-		bot:            bot,
-		adminID:        adminID,
-		developerID:    developerID,
-		adminChatID:    adminChatID,
-		userPrizeCodes: make(map[int64]string),
+		service:       service,
+		bot:           bot,
+		location:      cfg.Location,
+		workers:       cfg.Workers,
+		updateTimeout: cfg.UpdateTimeout,
 	}
 }
 
-// Start 🚀 Основной запуск бота
-func (h *Handler) Start() error {
+// Start 🚀 Основной запуск бота в режиме long polling; останавливается при отмене ctx
+func (h *Handler) Start(ctx context.Context) error {
+	// Пока зарегистрирован вебхук, getUpdates не работает: снимаем его, если бот раньше был в режиме вебхука
+	if _, err := h.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
 	updates := h.bot.GetUpdatesChan(u)
+	go func() {
+		<-ctx.Done()
+		h.bot.StopReceivingUpdates()
+	}()
 
+	d := newDispatcher(h.workers, h.updateTimeout, h.handleUpdate)
 	for update := range updates {
-		switch {
-		case update.Message != nil:
-			h.handleMessage(update.Message)
-		case update.CallbackQuery != nil:
-			h.handleCallback(update.CallbackQuery)
-		}
+		d.Dispatch(update)
 	}
+	d.Wait()
 	return nil
 }
 
+func (h *Handler) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	switch {
+	case update.Message != nil:
+		h.handleMessage(ctx, update.Message)
+	case update.CallbackQuery != nil:
+		h.handleCallback(ctx, update.CallbackQuery)
+	}
+}
+
 // 💬 Обработка обычных сообщений
-func (h *Handler) handleMessage(msg *tgbotapi.Message) {
-	ctx := context.Background()
+func (h *Handler) handleMessage(ctx context.Context, msg *tgbotapi.Message) {
+	// Любое сообщение в личке значит, что пользователь разблокировал бота (в том числе голый /start
+	// после кнопки "Start"), и рассылки ему снова можно слать
+	if msg.Chat.IsPrivate() {
+		if err := h.service.UnblockUser(ctx, msg.From.ID); err != nil {
+			log.Println("error service.UnblockUser:", err)
+		}
+	}
+
+	// Текущий шаг диалога пользователя в этом чате (привязка кода, рассылка, отмена активации)
+	conv, err := h.service.GetConversation(ctx, msg.From.ID, msg.Chat.ID)
+	if err != nil {
+		log.Println("error service.GetConversation:", err)
+		return
+	}
 
 	// Обработка полученного контакта
 	if msg.Contact != nil {
@@ -91,19 +115,19 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 		}
 
 		// Проверяем, что у пользователя есть сохраненный код приза
-		code, exists := h.userPrizeCodes[msg.From.ID]
-		if !exists {
+		if conv.Step != model.StepClaimPhone {
 			return
 		}
+		code := conv.Code
 
 		// Сохраняем номер телефона
-		err := h.service.UpdateUserPhone(ctx, msg.From.ID, msg.Contact.PhoneNumber)
+		err = h.service.UpdateUserPhone(ctx, msg.From.ID, msg.Contact.PhoneNumber)
 		if err != nil {
 			if errors.Is(err, errs.ErrPhoneAlreadyExists) {
 				reply := tgbotapi.NewMessage(msg.Chat.ID, "Этот номер телефона уже использовался для получения приза")
 				reply.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 				_, _ = h.bot.Send(reply)
-				delete(h.userPrizeCodes, msg.From.ID)
+				h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
 				return
 			}
 
@@ -111,18 +135,25 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 			reply := tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при сохранении номера телефона")
 			reply.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 			_, _ = h.bot.Send(reply)
-			delete(h.userPrizeCodes, msg.From.ID)
+			h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
 			return
 		}
 
 		// Присваиваем приз
 		err = h.service.AddTelegramIdIntoPrize(ctx, msg.From.ID, code)
+		if errors.Is(err, errs.ErrPrizeExpired) {
+			reply := tgbotapi.NewMessage(msg.Chat.ID, "⌛ Срок действия кода истек")
+			reply.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+			_, _ = h.bot.Send(reply)
+			h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
+			return
+		}
 		if err != nil {
 			log.Println("error service.AddTelegramIdIntoPrize:", err)
 			reply := tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при получении приза")
 			reply.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 			_, _ = h.bot.Send(reply)
-			delete(h.userPrizeCodes, msg.From.ID)
+			h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
 			return
 		}
 
@@ -130,121 +161,155 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 		prize, err := h.service.GetPrizeByUserID(ctx, msg.From.ID)
 		if err != nil {
 			log.Println("error service.GetPrizeByUserID:", err)
-			delete(h.userPrizeCodes, msg.From.ID)
+			h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
 			return
 		}
 
 		// Отправляем сообщение о получении приза
-		text := fmt.Sprintf("🎁Приз '%s' получен!\n🔢Ваш код - %s.\n\nПолучите свой приз с 1 по 31 января, предъявив код на кассе по адресу:\nТЦ Ладья, улица Дубравная 34/29\nКафе-Пекарня Миндальное Настроение", prize.Prize, code)
+		text := fmt.Sprintf("🎁Приз '%s' получен!\n🔢Ваш код - %s.\n\nПолучите свой приз %s, предъявив код на кассе %s",
+			prize.Prize, code, redeemPeriod(prize.Campaign, h.location), h.prizeStoresText(ctx, *prize))
 		prizeMessage := tgbotapi.NewMessage(msg.Chat.ID, text)
 		prizeMessage.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 		_, _ = h.bot.Send(prizeMessage)
 
-		// Удаляем код из хранилища
-		delete(h.userPrizeCodes, msg.From.ID)
+		// Диалог привязки кода завершен
+		h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
 		return
 	}
 
-	if msg.From.ID == h.adminID || msg.From.ID == h.developerID {
-		switch {
-		case msg.IsCommand() && msg.Command() == "info":
-			users, err := h.service.GetUsers(ctx)
-			if err != nil {
-				log.Println("error service.CreateUser: ", err)
-				message := tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при получении информации ❌")
-				message.ReplyToMessageID = msg.MessageID
-				_, _ = h.bot.Send(message)
-				return
-			}
+	// Команды сотрудников; права проверяются только для подходящей команды
+	if msg.IsCommand() && msg.Command() == "staff" && h.can(ctx, msg.From, model.PermManageStaff) {
+		h.handleStaff(ctx, msg)
+		return
+	}
 
-			// Разбиваем на части по 4000 символов (лимит Telegram - 4096)
-			const maxLen = 4000
-			var messages []string
-			current := ""
+	switch {
+	case msg.IsCommand() && msg.Command() == "info" && h.can(ctx, msg.From, model.PermViewUsers):
+		users, err := h.service.GetUsers(ctx)
+		if err != nil {
+			log.Println("error service.CreateUser: ", err)
+			message := tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при получении информации ❌")
+			message.ReplyToMessageID = msg.MessageID
+			_, _ = h.bot.Send(message)
+			return
+		}
 
-			for i, u := range users {
-				phone := "не указан"
-				if u.Phone != nil {
-					phone = *u.Phone
-				}
-				line := fmt.Sprintf("%d. ID: %d, Телефон: %s, Создан: %s\n",
-					i+1,
-					u.TelegramID,
-					phone,
-					u.CreatedAt.Format("2006-01-02"),
-				)
-				if len(current)+len(line) > maxLen {
-					messages = append(messages, current)
-					current = line
-				} else {
-					current += line
-				}
+		// Разбиваем на части по 4000 символов (лимит Telegram - 4096)
+		const maxLen = 4000
+		var messages []string
+		current := ""
+
+		for i, u := range users {
+			phone := "не указан"
+			if u.Phone != nil {
+				phone = *u.Phone
 			}
-			if current != "" {
+			line := fmt.Sprintf("%d. ID: %d, Телефон: %s, Создан: %s\n",
+				i+1,
+				u.TelegramID,
+				phone,
+				u.CreatedAt.In(h.location).Format("2006-01-02"),
+			)
+			if len(current)+len(line) > maxLen {
 				messages = append(messages, current)
+				current = line
+			} else {
+				current += line
 			}
+		}
+		if current != "" {
+			messages = append(messages, current)
+		}
 
-			// Отправляем все части
-			for i, text := range messages {
-				message := tgbotapi.NewMessage(msg.Chat.ID, text)
-				if i == 0 {
-					message.ReplyToMessageID = msg.MessageID
-				}
-				_, _ = h.bot.Send(message)
+		// Отправляем все части
+		for i, text := range messages {
+			message := tgbotapi.NewMessage(msg.Chat.ID, text)
+			if i == 0 {
+				message.ReplyToMessageID = msg.MessageID
 			}
-			return
-
-		case msg.IsCommand() && msg.Command() == "mail":
-			h.adminState = StateComposingMailing
+			_, _ = h.bot.Send(message)
+		}
+		return
 
-			reply := tgbotapi.NewMessage(msg.Chat.ID, "Отправьте сообщение для рассылки (текст, фото, видео или аудио):")
-			_, _ = h.bot.Send(reply)
+	case msg.IsCommand() && msg.Command() == "mail" && h.can(ctx, msg.From, model.PermBroadcast):
+		err := h.service.SaveConversation(ctx, model.Conversation{
+			UserID: msg.From.ID,
+			ChatID: msg.Chat.ID,
+			Step:   model.StepMailCompose,
+		})
+		if err != nil {
+			log.Println("error service.SaveConversation:", err)
+			_, _ = h.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Не удалось начать рассылку ❌"))
 			return
+		}
 
-		case h.adminState == StateComposingMailing:
-			// Сброс предыдущих данных
-			h.mailText = ""
-			h.mailMediaID = ""
-			h.mailMedia = MediaNone
-
-			// Определяем тип контента
-			switch {
-			case msg.Photo != nil && len(msg.Photo) > 0:
-				h.mailMediaID = msg.Photo[len(msg.Photo)-1].FileID
-				h.mailMedia = MediaPhoto
-				h.mailText = msg.Caption
-			case msg.Video != nil:
-				h.mailMediaID = msg.Video.FileID
-				h.mailMedia = MediaVideo
-				h.mailText = msg.Caption
-			case msg.Audio != nil:
-				h.mailMediaID = msg.Audio.FileID
-				h.mailMedia = MediaAudio
-				h.mailText = msg.Caption
-			case msg.Voice != nil:
-				h.mailMediaID = msg.Voice.FileID
-				h.mailMedia = MediaVoice
-			default:
-				h.mailText = msg.Text
-			}
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "Отправьте сообщение для рассылки (текст, фото, видео или аудио):")
+		_, _ = h.bot.Send(reply)
+		return
 
-			h.adminState = StateConfirmMailing
+	case conv.Step == model.StepMailCompose && h.can(ctx, msg.From, model.PermBroadcast):
+		// Черновик у каждого админа свой
+		draft := model.Conversation{
+			UserID: msg.From.ID,
+			ChatID: msg.Chat.ID,
+			Step:   model.StepMailSegment,
+		}
 
-			keyboard := tgbotapi.NewInlineKeyboardMarkup(
-				tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("Да", "mail_confirm"),
-					tgbotapi.NewInlineKeyboardButtonData("Нет", "mail_cancel"),
-				),
-			)
+		// Определяем тип контента
+		switch {
+		case msg.Photo != nil && len(msg.Photo) > 0:
+			draft.MailMediaID = msg.Photo[len(msg.Photo)-1].FileID
+			draft.MailMedia = string(MediaPhoto)
+			draft.MailText = msg.Caption
+		case msg.Video != nil:
+			draft.MailMediaID = msg.Video.FileID
+			draft.MailMedia = string(MediaVideo)
+			draft.MailText = msg.Caption
+		case msg.Audio != nil:
+			draft.MailMediaID = msg.Audio.FileID
+			draft.MailMedia = string(MediaAudio)
+			draft.MailText = msg.Caption
+		case msg.Voice != nil:
+			draft.MailMediaID = msg.Voice.FileID
+			draft.MailMedia = string(MediaVoice)
+		default:
+			draft.MailText = msg.Text
+		}
 
-			reply := tgbotapi.NewMessage(msg.Chat.ID, "Отправить это сообщение всем пользователям?")
-			reply.ReplyMarkup = keyboard
-			_, _ = h.bot.Send(reply)
+		if err := h.service.SaveConversation(ctx, draft); err != nil {
+			log.Println("error service.SaveConversation:", err)
+			_, _ = h.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Не удалось сохранить черновик рассылки ❌"))
 			return
 		}
+
+		h.askMailSegment(msg.Chat.ID)
+		return
+
+	case msg.IsCommand() && msg.Command() == "scheduled" && h.can(ctx, msg.From, model.PermBroadcast):
+		h.sendScheduledMailings(ctx, msg)
+		return
+
+	case (conv.Step == model.StepMailDates || conv.Step == model.StepMailSchedule) && msg.IsCommand() && msg.Command() == "cancel":
+		h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
+		_, _ = h.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Рассылка отменена."))
+		return
+
+	case conv.Step == model.StepMailDates && !msg.IsCommand() && h.can(ctx, msg.From, model.PermBroadcast):
+		h.handleMailDates(ctx, msg, conv)
+		return
+
+	case conv.Step == model.StepMailSchedule && !msg.IsCommand() && h.can(ctx, msg.From, model.PermBroadcast):
+		h.handleMailScheduleTime(ctx, msg)
+		return
 	}
+
 	switch msg.Command() {
 	case "start":
+		// Сотрудник, добавленный по @username, получает роль на своем первом /start
+		if err := h.service.BindStaff(ctx, msg.From.ID, msg.From.UserName); err != nil {
+			log.Println("error service.BindStaff:", err)
+		}
+
 		code := msg.CommandArguments()
 		if code == "" {
 			return
@@ -265,8 +330,11 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 			}
 			if prize != nil {
 				prizeState := "Еще не использован"
-				if prize.UsedAt != nil {
+				switch {
+				case prize.UsedAt != nil:
 					prizeState = "Использован"
+				case prize.Expired(time.Now()):
+					prizeState = "Срок действия истек"
 				}
 				msg := tgbotapi.NewMessage(msg.From.ID, fmt.Sprintf("Ваш приз: %s\n❗Статус: %s", prize.Prize, prizeState))
 				_, _ = h.bot.Send(msg)
@@ -274,8 +342,24 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 			}
 		}
 
+		// Просроченный код не даем привязывать, номер не спрашиваем
+		if prize, err := h.service.GetPrizeByCode(ctx, code); err == nil && prize.Expired(time.Now()) {
+			_, _ = h.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "⌛ Срок действия кода истек"))
+			return
+		}
+
 		// Сохраняем код для дальнейшего использования после получения номера
-		h.userPrizeCodes[msg.From.ID] = code
+		err = h.service.SaveConversation(ctx, model.Conversation{
+			UserID: msg.From.ID,
+			ChatID: msg.Chat.ID,
+			Step:   model.StepClaimPhone,
+			Code:   code,
+		})
+		if err != nil {
+			log.Println("error service.SaveConversation:", err)
+			_, _ = h.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при получении приза"))
+			return
+		}
 
 		// Отправляем запрос на получение номера телефона
 		phoneRequestBtn := tgbotapi.NewKeyboardButton("📱 Поделиться номером телефона")
@@ -292,18 +376,74 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 		return
 	}
 
-	// Только для группы администраторов
-	if msg.Chat.ID != h.adminChatID {
+	// Дальше - только чаты кассиров магазинов и только сотрудники с правом погашения
+	store, err := h.service.GetStoreByChatID(ctx, msg.Chat.ID)
+	if err != nil {
+		if !errors.Is(err, errs.ErrStoreNotFound) {
+			log.Println("error service.GetStoreByChatID:", err)
+		}
+		return
+	}
+	if !h.can(ctx, msg.From, model.PermRedeem) {
 		return
 	}
 
+	// Менеджер, нажавший "Отменить активацию", присылает причину следующим сообщением
+	if conv.Step == model.StepUndoReason {
+		if msg.IsCommand() && msg.Command() == "cancel" {
+			h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
+			message := tgbotapi.NewMessage(msg.Chat.ID, "Отмена активации прервана")
+			message.ReplyToMessageID = msg.MessageID
+			_, _ = h.bot.Send(message)
+			return
+		}
+		if !msg.IsCommand() && h.can(ctx, msg.From, model.PermUndoRedeem) {
+			h.undoActivation(ctx, msg, store, conv.Code)
+			return
+		}
+	}
+
+	if msg.IsCommand() && msg.Command() == "history" {
+		h.sendHistory(ctx, msg, store)
+		return
+	}
+	if msg.IsCommand() {
+		return
+	}
+
+	// Кассир может прислать фото QR-кода или штрихкода вместо ввода кода руками
 	code := strings.TrimSpace(msg.Text)
+	if len(msg.Photo) > 0 {
+		scanned, err := h.scanCode(ctx, msg.Photo)
+		if err != nil {
+			log.Println("error scanCode:", err)
+			message := tgbotapi.NewMessage(msg.Chat.ID, "Не удалось распознать код на фото, введите его вручную ❌")
+			message.ReplyToMessageID = msg.MessageID
+			_, _ = h.bot.Send(message)
+			return
+		}
+		code = scanned
+	}
+	if code == "" {
+		return
+	}
+
+	h.lookupCode(ctx, msg, store, code)
+}
 
+// 🔎 Поиск кода для кассира: статус и кнопка активации
+func (h *Handler) lookupCode(ctx context.Context, msg *tgbotapi.Message, store model.Store, code string) {
 	prize, err := h.service.GetPrizeByCode(ctx, code)
 	if err != nil {
 		// Логируем все ошибки, включая pgx. ErrNoRows
 		log.Printf("error service.GetPrizeByCode for code '%s': %v", code, err)
 
+		if errors.Is(err, errs.ErrCodeMistyped) {
+			message := tgbotapi.NewMessage(msg.Chat.ID, "Похоже, в коде опечатка, проверьте его ❌")
+			message.ReplyToMessageID = msg.MessageID
+			_, _ = h.bot.Send(message)
+			return
+		}
 		if errors.Is(err, pgx.ErrNoRows) {
 			message := tgbotapi.NewMessage(msg.Chat.ID, "Код не найден ❌")
 			message.ReplyToMessageID = msg.MessageID
@@ -314,7 +454,7 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 	}
 
 	// Проверка, привязан ли приз к телеграм айди или old_user
-	isValid, err := h.service.IsValidByCode(ctx, code)
+	isValid, err := h.service.IsValidByCode(ctx, prize.Code)
 	if !isValid || err != nil {
 		message := tgbotapi.NewMessage(msg.Chat.ID, "Код не привязан к телеграм айди ❌")
 		message.ReplyToMessageID = msg.MessageID
@@ -323,11 +463,23 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 	}
 
 	var text string
+	if prize.Expired(time.Now()) {
+		message := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🎁 Приз: %s\n⌛ Срок действия кода истек", prize.Prize))
+		message.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(message)
+		return
+	}
+	if prize.VoidedAt != nil && prize.UsedAt == nil {
+		message := tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("🎁 Приз: %s\n🚫 Код аннулирован", prize.Prize))
+		message.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(message)
+		return
+	}
 	if prize.UsedAt != nil {
 		text = fmt.Sprintf(
-			"🎁 Приз: %s\n✅ Активирован: %s (МСК)",
+			"🎁 Приз: %s\n✅ Активирован: %s",
 			prize.Prize,
-			prize.UsedAt.Format("02.01.2006 15:04"),
+			formatTime(*prize.UsedAt, store.Location),
 		)
 	} else {
 		text = fmt.Sprintf("🎁 Приз: %s\n❗ Код не активирован", prize.Prize)
@@ -336,52 +488,328 @@ func (h *Handler) handleMessage(msg *tgbotapi.Message) {
 	resp := tgbotapi.NewMessage(msg.Chat.ID, text)
 	resp.ReplyToMessageID = msg.MessageID
 
+	// Вне окна погашения акции и в чужом магазине код показываем, но не даем активировать
+	canRedeem := prize.Campaign.CanRedeemAt(time.Now()) && prize.ValidAt(store.ID)
+	if prize.UsedAt == nil && !prize.ValidAt(store.ID) {
+		resp.Text += "\n🏪 Приз нельзя получить в этом магазине"
+	} else if prize.UsedAt == nil && !canRedeem {
+		resp.Text += fmt.Sprintf("\n⛔ Погашение доступно %s", redeemPeriod(prize.Campaign, store.Location))
+	}
+
 	// Добавляем кнопку, если код не активирован
-	if prize.UsedAt == nil {
-		btn := tgbotapi.NewInlineKeyboardButtonData("Использовать", fmt.Sprintf("activate_%s", code))
+	if prize.UsedAt == nil && canRedeem {
+		btn := tgbotapi.NewInlineKeyboardButtonData("Использовать", fmt.Sprintf("activate_%s", prize.Code))
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(btn))
 		resp.ReplyMarkup = keyboard
 	}
+	if prize.UsedAt != nil {
+		resp.ReplyMarkup = undoKeyboard(prize.Code)
+	}
 
 	if _, err := h.bot.Send(resp); err != nil {
 		log.Printf("error bot.Send: %v", err)
 	}
 }
 
+// ↩️ Отмена активации: сообщение менеджера - это причина отмены
+func (h *Handler) undoActivation(ctx context.Context, msg *tgbotapi.Message, store model.Store, code string) {
+	actor := model.RedemptionActor{
+		TelegramID: msg.From.ID,
+		Username:   msg.From.UserName,
+		ChatID:     msg.Chat.ID,
+		MessageID:  msg.MessageID,
+		StoreID:    store.ID,
+	}
+
+	var text string
+	err := h.service.UndoActivation(ctx, code, actor, msg.Text)
+	switch {
+	case errors.Is(err, errs.ErrReasonRequired):
+		// Причину ждем дальше, без нее активацию не отменяем
+		message := tgbotapi.NewMessage(msg.Chat.ID, "Причина обязательна, напишите ее текстом (или /cancel)")
+		message.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(message)
+		return
+	case errors.Is(err, errs.ErrNotActivated):
+		text = fmt.Sprintf("Код %s не активирован, отменять нечего", code)
+	case errors.Is(err, errs.ErrPrizeNotFound):
+		text = "Код не найден ❌"
+	case errors.Is(err, errs.ErrWrongStore):
+		text = fmt.Sprintf("🏪 Код %s погашен в другом магазине, отменить активацию можно только там", code)
+	case err != nil:
+		log.Printf("error service.UndoActivation for code '%s': %v", code, err)
+		text = "⚠️ Не удалось отменить активацию"
+	default:
+		text = fmt.Sprintf("↩️ Активация кода %s отменена\n📝 Причина: %s", code, strings.TrimSpace(msg.Text))
+	}
+
+	h.endConversation(ctx, msg.From.ID, msg.Chat.ID)
+
+	message := tgbotapi.NewMessage(msg.Chat.ID, text)
+	message.ReplyToMessageID = msg.MessageID
+	_, _ = h.bot.Send(message)
+}
+
+// Завершает диалог; ошибку только логируем - просроченное состояние все равно не прочитается
+func (h *Handler) endConversation(ctx context.Context, userID, chatID int64) {
+	if err := h.service.EndConversation(ctx, userID, chatID); err != nil {
+		log.Println("error service.EndConversation:", err)
+	}
+}
+
+func undoKeyboard(code string) tgbotapi.InlineKeyboardMarkup {
+	btn := tgbotapi.NewInlineKeyboardButtonData("Отменить активацию", fmt.Sprintf("undo_%s", code))
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(btn))
+}
+
+// 📜 История попыток погашения кода: /history КОД
+func (h *Handler) sendHistory(ctx context.Context, msg *tgbotapi.Message, store model.Store) {
+	code := strings.TrimSpace(msg.CommandArguments())
+	if code == "" {
+		message := tgbotapi.NewMessage(msg.Chat.ID, "Укажите код: /history КОД")
+		message.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(message)
+		return
+	}
+
+	redemptions, err := h.service.GetRedemptions(ctx, code)
+	if err != nil {
+		log.Printf("error service.GetRedemptions for code '%s': %v", code, err)
+		message := tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при получении истории ❌")
+		message.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(message)
+		return
+	}
+
+	if len(redemptions) == 0 {
+		message := tgbotapi.NewMessage(msg.Chat.ID, "По этому коду еще не было попыток погашения")
+		message.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(message)
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "📜 История кода %s:\n", redemptions[0].Code)
+	for _, rd := range redemptions {
+		actor := fmt.Sprintf("ID %d", rd.Actor.TelegramID)
+		if rd.Actor.Username != "" {
+			actor = "@" + rd.Actor.Username + ", " + actor
+		}
+		fmt.Fprintf(&b, "\n%s - %s\n👤 %s, чат %d, сообщение %d\n",
+			rd.CreatedAt.In(store.Location).Format("02.01.2006 15:04:05 MST"),
+			redemptionResultText(rd.Result),
+			actor,
+			rd.Actor.ChatID,
+			rd.Actor.MessageID,
+		)
+		if rd.StoreName != "" {
+			fmt.Fprintf(&b, "🏪 %s\n", rd.StoreName)
+		}
+		if rd.Reason != "" {
+			fmt.Fprintf(&b, "📝 Причина: %s\n", rd.Reason)
+		}
+	}
+
+	message := tgbotapi.NewMessage(msg.Chat.ID, b.String())
+	message.ReplyToMessageID = msg.MessageID
+	if _, err := h.bot.Send(message); err != nil {
+		log.Printf("error bot.Send: %v", err)
+	}
+}
+
+func redemptionResultText(result string) string {
+	switch result {
+	case model.RedemptionActivated:
+		return "✅ активирован"
+	case model.RedemptionExpired:
+		return "⌛ отказ: срок истек"
+	case model.RedemptionVoided:
+		return "🚫 отказ: код аннулирован"
+	case model.RedemptionOutsideWindow:
+		return "⛔ отказ: вне периода погашения"
+	case model.RedemptionNotFound:
+		return "❌ отказ: код не найден"
+	case model.RedemptionFailed:
+		return "⚠️ ошибка активации"
+	case model.RedemptionAlreadyActivated:
+		return "🔁 отказ: код уже активирован"
+	case model.RedemptionUndone:
+		return "↩️ активация отменена"
+	case model.RedemptionWrongStore:
+		return "🏪 отказ: приз не действует в этом магазине"
+	default:
+		return result
+	}
+}
+
 // ⚙️ Обработка нажатий на кнопки
-func (h *Handler) handleCallback(cb *tgbotapi.CallbackQuery) {
-	ctx := context.Background()
+func (h *Handler) handleCallback(ctx context.Context, cb *tgbotapi.CallbackQuery) {
 	data := cb.Data
 
 	switch data {
 
 	case "mail_confirm":
-		err := h.service.Broadcast(ctx, h.mailText, h.mailMediaID, string(h.mailMedia))
+		if !h.can(ctx, cb.From, model.PermBroadcast) {
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Недостаточно прав"))
+			return
+		}
+
+		// Черновик забираем атомарно: повторное нажатие не запустит рассылку второй раз
+		draft, ok, err := h.service.TakeConversation(ctx, cb.From.ID, cb.Message.Chat.ID, model.StepMailConfirm)
 		if err != nil {
-			_, _ = h.bot.Send(tgbotapi.NewMessage(h.adminID, "Ошибка рассылки: "+err.Error()))
-		} else {
-			_, _ = h.bot.Send(tgbotapi.NewMessage(h.adminID, "Рассылка завершена."))
+			log.Println("error service.TakeConversation:", err)
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Ошибка, попробуйте еще раз"))
+			return
+		}
+		if !ok {
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Черновик рассылки не найден или устарел, начните заново: /mail"))
+			return
 		}
 
-		h.adminState = StateIdle
-		h.mailText = ""
-		h.mailMediaID = ""
-		h.mailMedia = MediaNone
+		// Отправка идет в фоне, прогресс бот показывает отдельным сообщением в этом чате
+		_, err = h.service.CreateMailing(ctx, mailingFromDraft(draft, nil))
+		if err != nil {
+			log.Println("error service.CreateMailing:", err)
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Ошибка рассылки, начните заново: /mail"))
+			return
+		}
+		_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, "Рассылка запущена"))
 		return
 
 	case "mail_cancel":
-		h.adminState = StateIdle
-		h.mailText = ""
-		h.mailMediaID = ""
-		h.mailMedia = MediaNone
+		if !h.can(ctx, cb.From, model.PermBroadcast) {
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Недостаточно прав"))
+			return
+		}
+
+		h.endConversation(ctx, cb.From.ID, cb.Message.Chat.ID)
 
 		_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, "Рассылка отменена."))
 	}
 
+	if data == "mail_schedule" {
+		h.handleMailSchedule(ctx, cb)
+		return
+	}
+
+	if strings.HasPrefix(data, mailUnschedulePrefix) {
+		h.handleMailUnschedule(ctx, cb)
+		return
+	}
+
+	if strings.HasPrefix(data, mailSegmentPrefix) {
+		h.handleMailSegment(ctx, cb)
+		return
+	}
+
+	if strings.HasPrefix(data, "undo_") {
+		code := strings.TrimPrefix(data, "undo_")
+
+		if !h.can(ctx, cb.From, model.PermUndoRedeem) {
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Отменить активацию может только менеджер"))
+			return
+		}
+
+		// Как и активация - только в чате кассиров того магазина, где код погасили
+		store, err := h.service.GetStoreByChatID(ctx, cb.Message.Chat.ID)
+		if err != nil {
+			log.Printf("error service.GetStoreByChatID for chat %d: %v", cb.Message.Chat.ID, err)
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Этот чат не привязан к магазину"))
+			return
+		}
+		err = h.service.CheckUndoStore(ctx, code, store.ID)
+		if errors.Is(err, errs.ErrWrongStore) {
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Код погашен в другом магазине, отменить активацию можно только там"))
+			return
+		}
+		if errors.Is(err, errs.ErrPrizeNotFound) {
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Код не найден"))
+			return
+		}
+		if err != nil {
+			log.Println("error service.CheckUndoStore:", err)
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Ошибка, попробуйте еще раз"))
+			return
+		}
+
+		err = h.service.SaveConversation(ctx, model.Conversation{
+			UserID: cb.From.ID,
+			ChatID: cb.Message.Chat.ID,
+			Step:   model.StepUndoReason,
+			Code:   code,
+		})
+		if err != nil {
+			log.Println("error service.SaveConversation:", err)
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Ошибка, попробуйте еще раз"))
+			return
+		}
+
+		text := fmt.Sprintf("Укажите причину отмены активации кода %s следующим сообщением (или /cancel)", code)
+		_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, text))
+		_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+		return
+	}
+
 	if strings.HasPrefix(data, "activate_") {
 		code := strings.TrimPrefix(data, "activate_")
 
-		err := h.service.ActivateCode(ctx, code)
+		if !h.can(ctx, cb.From, model.PermRedeem) {
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Активировать коды могут только кассиры"))
+			return
+		}
+
+		// Гасим только в чате кассиров магазина, его и записываем в журнал
+		store, err := h.service.GetStoreByChatID(ctx, cb.Message.Chat.ID)
+		if err != nil {
+			log.Printf("error service.GetStoreByChatID for chat %d: %v", cb.Message.Chat.ID, err)
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Этот чат не привязан к магазину"))
+			return
+		}
+
+		actor := model.RedemptionActor{
+			TelegramID: cb.From.ID,
+			Username:   cb.From.UserName,
+			ChatID:     cb.Message.Chat.ID,
+			MessageID:  cb.Message.MessageID,
+			StoreID:    store.ID,
+		}
+
+		err = h.service.ActivateCode(ctx, code, actor)
+		if errors.Is(err, errs.ErrAlreadyActivated) {
+			text := "⚠️ Код уже активирован"
+			if prize, err := h.service.GetPrizeByCode(ctx, code); err == nil && prize.UsedAt != nil {
+				text = fmt.Sprintf("🎁 Приз: %s\n⚠️ Код уже активирован: %s", prize.Prize, formatTime(*prize.UsedAt, store.Location))
+			}
+			edit := tgbotapi.NewEditMessageTextAndMarkup(cb.Message.Chat.ID, cb.Message.MessageID, text, undoKeyboard(code))
+			_, _ = h.bot.Send(edit)
+			_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Код уже активирован"))
+			return
+		}
+		if errors.Is(err, errs.ErrPrizeNotFound) {
+			_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, "Код не найден ❌"))
+			_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+			return
+		}
+		if errors.Is(err, errs.ErrPrizeExpired) {
+			_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, "⌛ Срок действия кода истек, активировать нельзя"))
+			_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+			return
+		}
+		if errors.Is(err, errs.ErrPrizeVoided) {
+			_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, "🚫 Код аннулирован, активировать нельзя"))
+			_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+			return
+		}
+		if errors.Is(err, errs.ErrWrongStore) {
+			_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, "🏪 Приз нельзя получить в этом магазине"))
+			_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+			return
+		}
+		if errors.Is(err, errs.ErrOutsideRedeemWindow) {
+			_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, "⛔ Акция не в периоде погашения, код активировать нельзя"))
+			_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+			return
+		}
 		if err != nil {
 			log.Printf("error ActivateCode: %v", err)
 			_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, "⚠️ Не удалось активировать код"))
@@ -396,12 +824,51 @@ func (h *Handler) handleCallback(cb *tgbotapi.CallbackQuery) {
 			return
 		}
 
-		text := fmt.Sprintf("🎁 Приз: %s\n✅ Активирован: %s (МСК)", prize.Prize, prize.UsedAt.Format("02.01.2006 15:04"))
+		text := fmt.Sprintf("🎁 Приз: %s\n✅ Активирован: %s", prize.Prize, formatTime(*prize.UsedAt, store.Location))
 
-		// Обновляем текст того же сообщения
-		edit := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID, text)
+		// Обновляем текст того же сообщения, оставляя менеджеру возможность отменить активацию
+		edit := tgbotapi.NewEditMessageTextAndMarkup(cb.Message.Chat.ID, cb.Message.MessageID, text, undoKeyboard(prize.Code))
 		_, _ = h.bot.Send(edit)
 	}
 
 	_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
 }
+
+// Где получить приз: магазины, в которых он действует, с адресом и часами работы
+func (h *Handler) prizeStoresText(ctx context.Context, prize model.Prize) string {
+	stores, err := h.service.GetPrizeStores(ctx, prize)
+	if err != nil {
+		log.Println("error service.GetPrizeStores:", err)
+	}
+	if len(stores) == 0 {
+		return "по адресу:\n" + prize.Campaign.Address
+	}
+
+	var b strings.Builder
+	if len(stores) == 1 {
+		b.WriteString("в магазине:")
+	} else {
+		b.WriteString("в одном из магазинов:")
+	}
+	for _, store := range stores {
+		b.WriteString("\n🏪 " + store.Name)
+		b.WriteString("\n📍 " + store.Address)
+		if store.Hours != "" {
+			b.WriteString("\n🕒 " + store.Hours)
+		}
+	}
+	return b.String()
+}
+
+// Период погашения для сообщений: конец окна не включается, поэтому показываем предыдущий день
+func redeemPeriod(c model.Campaign, loc *time.Location) string {
+	return fmt.Sprintf("с %s по %s",
+		c.RedeemStartsAt.In(loc).Format("02.01.2006"),
+		c.RedeemEndsAt.Add(-time.Second).In(loc).Format("02.01.2006"),
+	)
+}
+
+// Время для сообщений с обозначением пояса, например "01.01.2026 12:00 MSK"
+func formatTime(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("02.01.2006 15:04 MST")
+}
@@ -0,0 +1,439 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgbot-bad-da-yo/internal/repo/errs"
+	"tgbot-bad-da-yo/model"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	mailSegmentPrefix    = "mail_seg_"
+	mailUnschedulePrefix = "mail_unschedule_"
+)
+
+// Кнопки выбора аудитории рассылки
+func mailSegmentKeyboard() tgbotapi.InlineKeyboardMarkup {
+	button := func(text, kind string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(text, mailSegmentPrefix+kind)
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(button("Все пользователи", model.SegmentAll)),
+		tgbotapi.NewInlineKeyboardRow(button("С неиспользованным призом", model.SegmentUnredeemed)),
+		tgbotapi.NewInlineKeyboardRow(button("Погасившие приз", model.SegmentRedeemed)),
+		tgbotapi.NewInlineKeyboardRow(button("Без телефона", model.SegmentNoPhone)),
+		tgbotapi.NewInlineKeyboardRow(button("Зарегистрированные в период", model.SegmentRegistered)),
+		tgbotapi.NewInlineKeyboardRow(
+			button("Участники акции", model.SegmentCampaign),
+			button("Получатели приза", model.SegmentPrize),
+		),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Отмена", "mail_cancel")),
+	)
+}
+
+// askMailSegment показывает выбор аудитории под сохраненным черновиком
+func (h *Handler) askMailSegment(chatID int64) {
+	reply := tgbotapi.NewMessage(chatID, "Кому отправить рассылку?")
+	reply.ReplyMarkup = mailSegmentKeyboard()
+	_, _ = h.bot.Send(reply)
+}
+
+// 🎯 Выбор аудитории: mail_seg_<вид> или mail_seg_<вид>_<id> для акции и приза
+func (h *Handler) handleMailSegment(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+
+	if !h.can(ctx, cb.From, model.PermBroadcast) {
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Недостаточно прав"))
+		return
+	}
+
+	draft, err := h.service.GetConversation(ctx, cb.From.ID, chatID)
+	if err != nil {
+		log.Println("error service.GetConversation:", err)
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Ошибка, попробуйте еще раз"))
+		return
+	}
+	if draft.Step != model.StepMailSegment {
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Черновик рассылки не найден или устарел, начните заново: /mail"))
+		return
+	}
+	_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+
+	seg, withID := parseSegmentData(cb.Data)
+	kind := seg.Kind
+
+	switch {
+	case kind == model.SegmentRegistered:
+		draft.Step = model.StepMailDates
+		if err := h.service.SaveConversation(ctx, draft); err != nil {
+			log.Println("error service.SaveConversation:", err)
+			h.editMailPrompt(cb.Message, "Ошибка, попробуйте еще раз ❌", nil)
+			return
+		}
+		h.editMailPrompt(cb.Message, "Отправьте период регистрации в формате ДД.ММ.ГГГГ-ДД.ММ.ГГГГ (или /cancel)", nil)
+		return
+
+	case (kind == model.SegmentCampaign || kind == model.SegmentPrize) && !withID:
+		h.askSegmentOption(ctx, cb.Message, kind)
+		return
+	}
+
+	h.confirmMailing(ctx, cb.Message, draft, seg)
+}
+
+// parseSegmentData разбирает кнопку аудитории mail_seg_<вид>[_<id>]. Вид сам может содержать "_" (no_phone),
+// поэтому id ищется после последнего "_" и только если это число
+func parseSegmentData(data string) (seg model.Segment, withID bool) {
+	kind := strings.TrimPrefix(data, mailSegmentPrefix)
+	if i := strings.LastIndex(kind, "_"); i > 0 {
+		if id, err := strconv.ParseInt(kind[i+1:], 10, 64); err == nil {
+			return model.Segment{Kind: kind[:i], ID: id}, true
+		}
+	}
+	return model.Segment{Kind: kind}, false
+}
+
+// askSegmentOption предлагает выбрать конкретную акцию или приз каталога
+func (h *Handler) askSegmentOption(ctx context.Context, prompt *tgbotapi.Message, kind string) {
+	var options []model.SegmentOption
+	var err error
+	title := "Выберите акцию:"
+	if kind == model.SegmentCampaign {
+		options, err = h.service.GetCampaignOptions(ctx)
+	} else {
+		title = "Выберите приз:"
+		options, err = h.service.GetPrizeOptions(ctx)
+	}
+	if err != nil {
+		log.Println("error service.GetSegmentOptions:", err)
+		h.editMailPrompt(prompt, "Ошибка при получении списка ❌", nil)
+		return
+	}
+	if len(options) == 0 {
+		keyboard := mailSegmentKeyboard()
+		h.editMailPrompt(prompt, "Список пуст. Выберите другую аудиторию:", &keyboard)
+		return
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, o := range options {
+		data := fmt.Sprintf("%s%s_%d", mailSegmentPrefix, kind, o.ID)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(o.Name, data)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Отмена", "mail_cancel")))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	h.editMailPrompt(prompt, title, &keyboard)
+}
+
+// handleMailDates принимает период регистрации для аудитории рассылки
+func (h *Handler) handleMailDates(ctx context.Context, msg *tgbotapi.Message, draft model.Conversation) {
+	from, to, ok := parseDateRange(msg.Text, h.location)
+	if !ok {
+		reply := tgbotapi.NewMessage(msg.Chat.ID, "Не понял период. Пример: 01.09.2026-30.09.2026 (или /cancel)")
+		reply.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(reply)
+		return
+	}
+
+	draft.Step = model.StepMailSegment
+	h.confirmMailing(ctx, nil, draft, model.Segment{Kind: model.SegmentRegistered, From: &from, To: &to})
+}
+
+// confirmMailing показывает число получателей и просит подтвердить рассылку.
+// prompt - сообщение с кнопками выбора, nil - отправить новое
+func (h *Handler) confirmMailing(ctx context.Context, prompt *tgbotapi.Message, draft model.Conversation, seg model.Segment) {
+	show := func(text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+		if prompt != nil {
+			h.editMailPrompt(prompt, text, keyboard)
+			return
+		}
+		reply := tgbotapi.NewMessage(draft.ChatID, text)
+		if keyboard != nil {
+			reply.ReplyMarkup = *keyboard
+		}
+		_, _ = h.bot.Send(reply)
+	}
+
+	count, err := h.service.CountSegment(ctx, seg)
+	if err != nil {
+		log.Println("error service.CountSegment:", err)
+		show("Ошибка при подсчете получателей ❌", nil)
+		return
+	}
+	if count == 0 {
+		draft.Step = model.StepMailSegment
+		if err := h.service.SaveConversation(ctx, draft); err != nil {
+			log.Println("error service.SaveConversation:", err)
+		}
+		keyboard := mailSegmentKeyboard()
+		show("В этой аудитории нет получателей. Выберите другую:", &keyboard)
+		return
+	}
+
+	draft.Step = model.StepMailConfirm
+	draft.MailSegment = &seg
+	if err := h.service.SaveConversation(ctx, draft); err != nil {
+		log.Println("error service.SaveConversation:", err)
+		show("Не удалось сохранить черновик рассылки ❌", nil)
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Да", "mail_confirm"),
+			tgbotapi.NewInlineKeyboardButtonData("Нет", "mail_cancel"),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🕘 Отправить в…", "mail_schedule"),
+		),
+	)
+	show(fmt.Sprintf("Получателей сейчас: %d. Отправить рассылку?", count), &keyboard)
+}
+
+// 🕘 "Отправить в…": просим дату и время отправки в часовом поясе чата
+func (h *Handler) handleMailSchedule(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	chatID := cb.Message.Chat.ID
+
+	if !h.can(ctx, cb.From, model.PermBroadcast) {
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Недостаточно прав"))
+		return
+	}
+
+	draft, err := h.service.GetConversation(ctx, cb.From.ID, chatID)
+	if err != nil {
+		log.Println("error service.GetConversation:", err)
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Ошибка, попробуйте еще раз"))
+		return
+	}
+	if draft.Step != model.StepMailConfirm {
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Черновик рассылки не найден или устарел, начните заново: /mail"))
+		return
+	}
+
+	draft.Step = model.StepMailSchedule
+	if err := h.service.SaveConversation(ctx, draft); err != nil {
+		log.Println("error service.SaveConversation:", err)
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Ошибка, попробуйте еще раз"))
+		return
+	}
+	_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, ""))
+
+	loc := h.chatLocation(ctx, chatID)
+	text := fmt.Sprintf("Когда отправить? Дата и время в формате ДД.ММ.ГГГГ ЧЧ:ММ, часовой пояс %s (или /cancel)", loc)
+	h.editMailPrompt(cb.Message, text, nil)
+}
+
+// handleMailScheduleTime принимает время отложенной рассылки и ставит ее в очередь
+func (h *Handler) handleMailScheduleTime(ctx context.Context, msg *tgbotapi.Message) {
+	reply := func(text string) {
+		message := tgbotapi.NewMessage(msg.Chat.ID, text)
+		message.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(message)
+	}
+
+	loc := h.chatLocation(ctx, msg.Chat.ID)
+	at, ok := parseScheduleTime(msg.Text, loc)
+	if !ok {
+		reply("Не понял время. Пример: 25.10.2026 09:00 (или /cancel)")
+		return
+	}
+	if !at.After(time.Now()) {
+		reply("Это время уже прошло, укажите будущее (или /cancel)")
+		return
+	}
+
+	// Черновик забираем атомарно, как и при немедленной отправке
+	draft, ok, err := h.service.TakeConversation(ctx, msg.From.ID, msg.Chat.ID, model.StepMailSchedule)
+	if err != nil {
+		log.Println("error service.TakeConversation:", err)
+		reply("Ошибка, попробуйте еще раз ❌")
+		return
+	}
+	if !ok {
+		reply("Черновик рассылки не найден или устарел, начните заново: /mail")
+		return
+	}
+
+	m, err := h.service.CreateMailing(ctx, mailingFromDraft(draft, &at))
+	if err != nil {
+		log.Println("error service.CreateMailing:", err)
+		reply("Не удалось запланировать рассылку, начните заново: /mail ❌")
+		return
+	}
+
+	reply(fmt.Sprintf("🕘 Рассылка #%d запланирована на %s. Список отложенных: /scheduled", m.ID, formatTime(at, loc)))
+}
+
+// 🗓 /scheduled - отложенные рассылки с кнопками отмены
+func (h *Handler) sendScheduledMailings(ctx context.Context, msg *tgbotapi.Message) {
+	mailings, err := h.service.GetScheduledMailings(ctx)
+	if err != nil {
+		log.Println("error service.GetScheduledMailings:", err)
+		_, _ = h.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при получении отложенных рассылок ❌"))
+		return
+	}
+	if len(mailings) == 0 {
+		_, _ = h.bot.Send(tgbotapi.NewMessage(msg.Chat.ID, "Отложенных рассылок нет"))
+		return
+	}
+
+	loc := h.chatLocation(ctx, msg.Chat.ID)
+
+	var b strings.Builder
+	var rows [][]tgbotapi.InlineKeyboardButton
+	b.WriteString("🗓 Отложенные рассылки:\n")
+	for _, m := range mailings {
+		fmt.Fprintf(&b, "\n#%d - %s\nКому: %s\n%s\n", m.ID, formatTime(*m.ScheduledAt, loc), segmentText(m.Segment, loc), mailingPreview(m))
+
+		data := fmt.Sprintf("%s%d", mailUnschedulePrefix, m.ID)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("Отменить #%d", m.ID), data),
+		))
+	}
+
+	reply := tgbotapi.NewMessage(msg.Chat.ID, b.String())
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	_, _ = h.bot.Send(reply)
+}
+
+// Отмена отложенной рассылки кнопкой из /scheduled
+func (h *Handler) handleMailUnschedule(ctx context.Context, cb *tgbotapi.CallbackQuery) {
+	if !h.can(ctx, cb.From, model.PermBroadcast) {
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Недостаточно прав"))
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(cb.Data, mailUnschedulePrefix), 10, 64)
+	if err != nil {
+		return
+	}
+
+	err = h.service.CancelMailing(ctx, id)
+	switch {
+	case errors.Is(err, errs.ErrMailingNotFound):
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Рассылка уже началась или отменена"))
+		return
+	case err != nil:
+		log.Println("error service.CancelMailing:", err)
+		_, _ = h.bot.Request(tgbotapi.NewCallbackWithAlert(cb.ID, "Ошибка, попробуйте еще раз"))
+		return
+	}
+
+	_, _ = h.bot.Request(tgbotapi.NewCallback(cb.ID, "Рассылка отменена"))
+	_, _ = h.bot.Send(tgbotapi.NewMessage(cb.Message.Chat.ID, fmt.Sprintf("🚫 Рассылка #%d отменена", id)))
+}
+
+// mailingFromDraft собирает рассылку из черновика; at - время отложенной отправки, nil - сразу
+func mailingFromDraft(draft model.Conversation, at *time.Time) model.Mailing {
+	segment := model.Segment{Kind: model.SegmentAll}
+	if draft.MailSegment != nil {
+		segment = *draft.MailSegment
+	}
+
+	return model.Mailing{
+		Segment:     segment,
+		ScheduledAt: at,
+		Text:        draft.MailText,
+		MediaID:     draft.MailMediaID,
+		MediaType:   draft.MailMedia,
+		CreatedBy:   draft.UserID,
+		ChatID:      draft.ChatID,
+	}
+}
+
+// chatLocation - часовой пояс магазина, если это чат его кассиров, иначе пояс бота
+func (h *Handler) chatLocation(ctx context.Context, chatID int64) *time.Location {
+	store, err := h.service.GetStoreByChatID(ctx, chatID)
+	if err != nil {
+		if !errors.Is(err, errs.ErrStoreNotFound) {
+			log.Println("error service.GetStoreByChatID:", err)
+		}
+		return h.location
+	}
+	return store.Location
+}
+
+// segmentText описывает аудиторию рассылки для списка отложенных
+func segmentText(seg model.Segment, loc *time.Location) string {
+	switch seg.Kind {
+	case model.SegmentUnredeemed:
+		return "с неиспользованным призом"
+	case model.SegmentRedeemed:
+		return "погасившие приз"
+	case model.SegmentNoPhone:
+		return "без телефона"
+	case model.SegmentRegistered:
+		if seg.From == nil || seg.To == nil {
+			return "зарегистрированные в период"
+		}
+		return fmt.Sprintf("зарегистрированные %s-%s",
+			seg.From.In(loc).Format("02.01.2006"), seg.To.In(loc).AddDate(0, 0, -1).Format("02.01.2006"))
+	case model.SegmentCampaign:
+		return fmt.Sprintf("участники акции #%d", seg.ID)
+	case model.SegmentPrize:
+		return fmt.Sprintf("получатели приза #%d", seg.ID)
+	default:
+		return "все пользователи"
+	}
+}
+
+// mailingPreview - начало текста рассылки и тип вложения
+func mailingPreview(m model.Mailing) string {
+	const maxRunes = 60
+
+	text := []rune(strings.TrimSpace(m.Text))
+	preview := string(text)
+	if len(text) > maxRunes {
+		preview = string(text[:maxRunes]) + "…"
+	}
+	if m.MediaType != "" {
+		preview = "[" + m.MediaType + "] " + preview
+	}
+	return preview
+}
+
+// editMailPrompt заменяет текст и кнопки сообщения с выбором аудитории
+func (h *Handler) editMailPrompt(prompt *tgbotapi.Message, text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(prompt.Chat.ID, prompt.MessageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := h.bot.Request(edit); err != nil {
+		log.Println("error edit mailing prompt:", err)
+	}
+}
+
+// parseScheduleTime разбирает время отложенной рассылки "ДД.ММ.ГГГГ ЧЧ:ММ" в поясе loc, лишние пробелы не мешают
+func parseScheduleTime(s string, loc *time.Location) (time.Time, bool) {
+	at, err := time.ParseInLocation("02.01.2006 15:04", strings.Join(strings.Fields(s), " "), loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// parseDateRange разбирает период "ДД.ММ.ГГГГ-ДД.ММ.ГГГГ" в поясе loc; конец включается целиком
+func parseDateRange(s string, loc *time.Location) (from, to time.Time, ok bool) {
+	rawFrom, rawTo, found := strings.Cut(strings.TrimSpace(s), "-")
+	if !found {
+		return from, to, false
+	}
+
+	from, err := time.ParseInLocation("02.01.2006", strings.TrimSpace(rawFrom), loc)
+	if err != nil {
+		return from, to, false
+	}
+	last, err := time.ParseInLocation("02.01.2006", strings.TrimSpace(rawTo), loc)
+	if err != nil || last.Before(from) {
+		return from, to, false
+	}
+
+	return from, last.AddDate(0, 0, 1), true
+}
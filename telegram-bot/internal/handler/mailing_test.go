@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"testing"
+	"tgbot-bad-da-yo/model"
+	"time"
+)
+
+func TestParseSegmentData(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		want       model.Segment
+		wantWithID bool
+	}{
+		{name: "all", data: mailSegmentPrefix + "all", want: model.Segment{Kind: model.SegmentAll}},
+		{name: "kind with underscore", data: mailSegmentPrefix + "no_phone", want: model.Segment{Kind: model.SegmentNoPhone}},
+		{name: "campaign choice", data: mailSegmentPrefix + "campaign", want: model.Segment{Kind: model.SegmentCampaign}},
+		{name: "campaign with id", data: mailSegmentPrefix + "campaign_12", want: model.Segment{Kind: model.SegmentCampaign, ID: 12}, wantWithID: true},
+		{name: "prize with id", data: mailSegmentPrefix + "prize_3", want: model.Segment{Kind: model.SegmentPrize, ID: 3}, wantWithID: true},
+		{name: "non numeric suffix", data: mailSegmentPrefix + "prize_x", want: model.Segment{Kind: "prize_x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, withID := parseSegmentData(tt.data)
+			if got.Kind != tt.want.Kind || got.ID != tt.want.ID || withID != tt.wantWithID {
+				t.Fatalf("parseSegmentData(%q) = %+v, %v, want %+v, %v", tt.data, got, withID, tt.want, tt.wantWithID)
+			}
+		})
+	}
+}
+
+func TestParseDateRange(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		in       string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantOK   bool
+	}{
+		{
+			name:     "week",
+			in:       "01.10.2026-07.10.2026",
+			wantFrom: time.Date(2026, 10, 1, 0, 0, 0, 0, moscow),
+			wantTo:   time.Date(2026, 10, 8, 0, 0, 0, 0, moscow),
+			wantOK:   true,
+		},
+		{
+			name:     "single day with spaces",
+			in:       " 15.10.2026 - 15.10.2026 ",
+			wantFrom: time.Date(2026, 10, 15, 0, 0, 0, 0, moscow),
+			wantTo:   time.Date(2026, 10, 16, 0, 0, 0, 0, moscow),
+			wantOK:   true,
+		},
+		{
+			name:     "across year",
+			in:       "30.12.2026-01.01.2027",
+			wantFrom: time.Date(2026, 12, 30, 0, 0, 0, 0, moscow),
+			wantTo:   time.Date(2027, 1, 2, 0, 0, 0, 0, moscow),
+			wantOK:   true,
+		},
+		{name: "reversed", in: "07.10.2026-01.10.2026"},
+		{name: "single date", in: "01.10.2026"},
+		{name: "iso dates", in: "2026-10-01-2026-10-07"},
+		{name: "invalid day", in: "32.10.2026-01.11.2026"},
+		{name: "empty", in: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, ok := parseDateRange(tt.in, moscow)
+			if ok != tt.wantOK {
+				t.Fatalf("parseDateRange(%q) ok = %v, want %v", tt.in, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !from.Equal(tt.wantFrom) || !to.Equal(tt.wantTo) {
+				t.Fatalf("parseDateRange(%q) = %s - %s, want %s - %s", tt.in, from, to, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestParseScheduleTime(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		in     string
+		want   time.Time
+		wantOK bool
+	}{
+		{name: "exact", in: "25.10.2026 09:00", want: time.Date(2026, 10, 25, 6, 0, 0, 0, time.UTC), wantOK: true},
+		{name: "extra spaces", in: "  25.10.2026    09:00\n", want: time.Date(2026, 10, 25, 6, 0, 0, 0, time.UTC), wantOK: true},
+		{name: "midnight", in: "01.01.2027 00:00", want: time.Date(2026, 12, 31, 21, 0, 0, 0, time.UTC), wantOK: true},
+		{name: "no time", in: "25.10.2026"},
+		{name: "no date", in: "09:00"},
+		{name: "seconds", in: "25.10.2026 09:00:00"},
+		{name: "invalid hour", in: "25.10.2026 25:00"},
+		{name: "iso", in: "2026-10-25 09:00"},
+		{name: "empty", in: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, ok := parseScheduleTime(tt.in, moscow)
+			if ok != tt.wantOK {
+				t.Fatalf("parseScheduleTime(%q) ok = %v, want %v", tt.in, ok, tt.wantOK)
+			}
+			if ok && !at.Equal(tt.want) {
+				t.Fatalf("parseScheduleTime(%q) = %s, want %s", tt.in, at.UTC(), tt.want)
+			}
+		})
+	}
+}
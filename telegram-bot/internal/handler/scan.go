@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/oned"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+var errNoCodeInImage = errors.New("no qr code or barcode found")
+
+var photoClient = &http.Client{Timeout: 15 * time.Second}
+
+// Распознает код на фото из чата кассиров. Телеграм присылает фото в нескольких
+// размерах: пробуем с самого крупного, мелкие - запасной вариант
+func (h *Handler) scanCode(ctx context.Context, photos []tgbotapi.PhotoSize) (string, error) {
+	var lastErr error = errNoCodeInImage
+	for i := len(photos) - 1; i >= 0 && i >= len(photos)-2; i-- {
+		img, err := h.downloadPhoto(ctx, photos[i].FileID)
+		if err != nil {
+			return "", err
+		}
+
+		text, err := decodeImage(img)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if code := codeFromPayload(text); code != "" {
+			return code, nil
+		}
+	}
+
+	return "", lastErr
+}
+
+// Скачивает фото в рамках таймаута апдейта. Ссылки на файлы содержат токен бота,
+// поэтому в ошибки попадает только причина, без URL
+func (h *Handler) downloadPhoto(ctx context.Context, fileID string) (image.Image, error) {
+	link, err := h.bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file url: %w", withoutURL(err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, errors.New("failed to build photo request")
+	}
+
+	resp, err := photoClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download photo: %w", withoutURL(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download photo: status %d", resp.StatusCode)
+	}
+
+	img, _, err := image.Decode(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode photo: %w", err)
+	}
+
+	return img, nil
+}
+
+// withoutURL убирает из ошибки HTTP-клиента адрес запроса, оставляя причину
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// Ищет на изображении QR-код или буквенно-цифровой штрихкод
+func decodeImage(img image.Image) (string, error) {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare image: %w", err)
+	}
+
+	hints := map[gozxing.DecodeHintType]interface{}{
+		gozxing.DecodeHintType_TRY_HARDER: true,
+	}
+
+	readers := []gozxing.Reader{
+		qrcode.NewQRCodeReader(),
+		oned.NewCode128Reader(),
+		oned.NewCode39Reader(),
+		oned.NewCode93Reader(),
+	}
+	for _, reader := range readers {
+		result, err := reader.Decode(bmp, hints)
+		if err == nil {
+			return result.GetText(), nil
+		}
+	}
+
+	return "", errNoCodeInImage
+}
+
+// Достает код из содержимого QR: ссылки t.me/<бот>?start=<код>, команды /start <код> или самого кода
+func codeFromPayload(text string) string {
+	text = strings.TrimSpace(text)
+
+	if u, err := url.Parse(text); err == nil && u.Host != "" {
+		return strings.TrimSpace(u.Query().Get("start"))
+	}
+	if arg, ok := strings.CutPrefix(text, "/start "); ok {
+		return strings.TrimSpace(arg)
+	}
+
+	return text
+}
@@ -0,0 +1,29 @@
+package handler
+
+import "testing"
+
+func TestCodeFromPayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{name: "plain code", payload: "A2B3C4D", want: "A2B3C4D"},
+		{name: "plain code with spaces", payload: "  A2B3C4D\n", want: "A2B3C4D"},
+		{name: "deep link", payload: "https://t.me/some_bot?start=A2B3C4D", want: "A2B3C4D"},
+		{name: "deep link with other params", payload: "https://t.me/some_bot?utm=qr&start=A2B3C4D", want: "A2B3C4D"},
+		{name: "link without start", payload: "https://t.me/some_bot", want: ""},
+		{name: "start command", payload: "/start A2B3C4D", want: "A2B3C4D"},
+		{name: "start command with spaces", payload: "/start   A2B3C4D ", want: "A2B3C4D"},
+		{name: "printed code with dash", payload: "A2B-3C4D", want: "A2B-3C4D"},
+		{name: "empty", payload: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := codeFromPayload(tt.payload); got != tt.want {
+				t.Fatalf("codeFromPayload(%q) = %q, want %q", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"tgbot-bad-da-yo/internal/repo/errs"
+	"tgbot-bad-da-yo/model"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const staffUsage = "Команды:\n/staff - список сотрудников\n/staff add @user роль\n/staff remove @user\n\nРоли: owner, admin, cashier, developer. Вместо @user можно указать telegram ID. Добавленный по @user получит роль, когда отправит боту /start"
+
+// can - единая проверка прав для команд и кнопок сотрудников
+func (h *Handler) can(ctx context.Context, user *tgbotapi.User, perm model.Permission) bool {
+	if user == nil {
+		return false
+	}
+
+	ok, err := h.service.Can(ctx, user.ID, perm)
+	if err != nil {
+		log.Printf("error service.Can for user %d: %v", user.ID, err)
+		return false
+	}
+	return ok
+}
+
+// 👥 Управление сотрудниками: /staff, /staff add, /staff remove
+func (h *Handler) handleStaff(ctx context.Context, msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+
+	reply := func(text string) {
+		message := tgbotapi.NewMessage(msg.Chat.ID, text)
+		message.ReplyToMessageID = msg.MessageID
+		_, _ = h.bot.Send(message)
+	}
+
+	if len(args) == 0 || args[0] == "list" {
+		members, err := h.service.ListStaff(ctx)
+		if err != nil {
+			log.Println("error service.ListStaff:", err)
+			reply("Ошибка при получении списка сотрудников ❌")
+			return
+		}
+		reply(staffListText(members))
+		return
+	}
+
+	role, err := h.service.StaffRole(ctx, msg.From.ID)
+	if err != nil {
+		log.Println("error service.StaffRole:", err)
+		reply("Ошибка при проверке прав ❌")
+		return
+	}
+	actor := model.StaffMember{TelegramID: &msg.From.ID, Role: role}
+	if msg.From.UserName != "" {
+		username := strings.ToLower(msg.From.UserName)
+		actor.Username = &username
+	}
+
+	switch {
+	case args[0] == "add" && len(args) == 3:
+		target, ok := parseStaffTarget(args[1])
+		if !ok {
+			reply("Укажите @username или telegram ID сотрудника")
+			return
+		}
+		if target.Role, ok = model.ParseRole(args[2]); !ok {
+			reply("Неизвестная роль. " + staffUsage)
+			return
+		}
+
+		err = h.service.AddStaff(ctx, actor, target)
+		switch {
+		case errors.Is(err, errs.ErrForbidden):
+			reply("Недостаточно прав, чтобы выдать эту роль ❌")
+		case err != nil:
+			log.Println("error service.AddStaff:", err)
+			reply("Ошибка при добавлении сотрудника ❌")
+		default:
+			reply(fmt.Sprintf("✅ %s теперь %s", args[1], target.Role))
+		}
+
+	case args[0] == "remove" && len(args) == 2:
+		target, ok := parseStaffTarget(args[1])
+		if !ok {
+			reply("Укажите @username или telegram ID сотрудника")
+			return
+		}
+
+		err = h.service.RemoveStaff(ctx, actor, target)
+		switch {
+		case errors.Is(err, errs.ErrStaffNotFound):
+			reply("Такого сотрудника нет ❌")
+		case errors.Is(err, errs.ErrForbidden):
+			reply("Недостаточно прав, чтобы удалить этого сотрудника ❌")
+		case err != nil:
+			log.Println("error service.RemoveStaff:", err)
+			reply("Ошибка при удалении сотрудника ❌")
+		default:
+			reply(fmt.Sprintf("✅ %s больше не сотрудник", args[1]))
+		}
+
+	default:
+		reply(staffUsage)
+	}
+}
+
+// Сотрудник из аргумента команды: @username или числовой telegram ID
+func parseStaffTarget(s string) (model.StaffMember, bool) {
+	if username, ok := strings.CutPrefix(s, "@"); ok {
+		if username == "" {
+			return model.StaffMember{}, false
+		}
+		username = strings.ToLower(username)
+		return model.StaffMember{Username: &username}, true
+	}
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return model.StaffMember{}, false
+	}
+	return model.StaffMember{TelegramID: &id}, true
+}
+
+func staffListText(members []model.StaffMember) string {
+	if len(members) == 0 {
+		return "Сотрудников пока нет\n\n" + staffUsage
+	}
+
+	var b strings.Builder
+	b.WriteString("👥 Сотрудники:\n")
+	for _, m := range members {
+		var who []string
+		if m.Username != nil {
+			who = append(who, "@"+*m.Username)
+		}
+		if m.TelegramID != nil {
+			who = append(who, fmt.Sprintf("ID %d", *m.TelegramID))
+		} else {
+			who = append(who, "еще не писал боту")
+		}
+		fmt.Fprintf(&b, "\n%s - %s", strings.Join(who, ", "), m.Role)
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// WebhookConfig - настройки режима вебхука
+type WebhookConfig struct {
+	// Публичный адрес, который регистрируем в Telegram, например https://bot.example.com/telegram
+	URL string
+	// Адрес HTTP-сервера бота, например :8081
+	Listen string
+	// Секрет, который Telegram присылает в заголовке X-Telegram-Bot-Api-Secret-Token
+	Secret string
+	// Снимать вебхук при остановке. По умолчанию нет: при нескольких репликах или масштабировании до нуля
+	// остановка одного экземпляра иначе отключила бы вебхук для всех
+	DeleteOnShutdown bool
+}
+
+// StartWebhook 🌐 Запуск в режиме вебхука: регистрирует вебхук, принимает апдейты по HTTP
+// и при отмене ctx дожидается обработки принятых апдейтов
+func (h *Handler) StartWebhook(ctx context.Context, cfg WebhookConfig) error {
+	if cfg.Secret == "" {
+		return errors.New("webhook secret is required")
+	}
+	link, err := url.Parse(cfg.URL)
+	if err != nil || link.Scheme != "https" || link.Host == "" {
+		return fmt.Errorf("webhook url must be an absolute https url: %q", cfg.URL)
+	}
+	path := link.Path
+	if path == "" {
+		path = "/"
+	}
+
+	d := newDispatcher(h.workers, h.updateTimeout, h.handleUpdate)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(webhookSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(cfg.Secret)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		update, err := h.bot.HandleUpdate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		d.Dispatch(*update)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	_, err = h.bot.MakeRequest("setWebhook", tgbotapi.Params{
+		"url":          cfg.URL,
+		"secret_token": cfg.Secret,
+	})
+	if err != nil {
+		_ = server.Close()
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	log.Printf("вебхук зарегистрирован, слушаем %s%s", cfg.Listen, path)
+
+	select {
+	case err = <-serverErr:
+	case <-ctx.Done():
+	}
+
+	// Вебхук снимаем до остановки сервера, чтобы Telegram не слал апдейты в пустоту.
+	// Иначе он остается зарегистрированным, а апдейты Telegram придержит до следующего запуска
+	if cfg.DeleteOnShutdown {
+		if _, derr := h.bot.Request(tgbotapi.DeleteWebhookConfig{}); derr != nil {
+			log.Println("error deleteWebhook:", derr)
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if serr := server.Shutdown(shutdownCtx); serr != nil {
+		log.Println("error server.Shutdown:", serr)
+	}
+	d.Wait()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("webhook server: %w", err)
+	}
+	return nil
+}
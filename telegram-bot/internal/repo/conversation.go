@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"tgbot-bad-da-yo/model"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetConversation возвращает непросроченное состояние диалога; пустой Step - диалога нет
+func (r *Repository) GetConversation(ctx context.Context, userID, chatID int64) (model.Conversation, error) {
+	conv := model.Conversation{UserID: userID, ChatID: chatID}
+
+	var data []byte
+	err := r.pool.QueryRow(ctx, `
+		SELECT step, data
+		FROM conversation_states
+		WHERE user_id = $1 AND chat_id = $2 AND expires_at > CURRENT_TIMESTAMP`,
+		userID, chatID).Scan(&conv.Step, &data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return conv, nil
+	}
+	if err != nil {
+		return conv, fmt.Errorf("error GetConversation: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &conv); err != nil {
+		return conv, fmt.Errorf("error GetConversation unmarshal: %w", err)
+	}
+	return conv, nil
+}
+
+// SaveConversation сохраняет шаг диалога и продлевает его на ttl
+func (r *Repository) SaveConversation(ctx context.Context, conv model.Conversation, ttl time.Duration) error {
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return fmt.Errorf("error SaveConversation marshal: %w", err)
+	}
+
+	_, err = r.pool.Exec(ctx, `
+		INSERT INTO conversation_states (user_id, chat_id, step, data, expires_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP + make_interval(secs => $5))
+		ON CONFLICT (user_id, chat_id) DO UPDATE
+		SET step = EXCLUDED.step, data = EXCLUDED.data,
+		    expires_at = EXCLUDED.expires_at, updated_at = CURRENT_TIMESTAMP`,
+		conv.UserID, conv.ChatID, conv.Step, data, ttl.Seconds())
+	if err != nil {
+		return fmt.Errorf("error SaveConversation: %w", err)
+	}
+	return nil
+}
+
+// TakeConversation атомарно забирает состояние нужного шага: из двух одновременных
+// нажатий кнопки его получит только одно
+func (r *Repository) TakeConversation(ctx context.Context, userID, chatID int64, step string) (model.Conversation, bool, error) {
+	conv := model.Conversation{UserID: userID, ChatID: chatID, Step: step}
+
+	var data []byte
+	err := r.pool.QueryRow(ctx, `
+		DELETE FROM conversation_states
+		WHERE user_id = $1 AND chat_id = $2 AND step = $3 AND expires_at > CURRENT_TIMESTAMP
+		RETURNING data`,
+		userID, chatID, step).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return conv, false, nil
+	}
+	if err != nil {
+		return conv, false, fmt.Errorf("error TakeConversation: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &conv); err != nil {
+		return conv, false, fmt.Errorf("error TakeConversation unmarshal: %w", err)
+	}
+	return conv, true, nil
+}
+
+// DeleteConversation завершает диалог
+func (r *Repository) DeleteConversation(ctx context.Context, userID, chatID int64) error {
+	_, err := r.pool.Exec(ctx, `
+		DELETE FROM conversation_states WHERE user_id = $1 AND chat_id = $2`,
+		userID, chatID)
+	if err != nil {
+		return fmt.Errorf("error DeleteConversation: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredConversations удаляет брошенные диалоги
+func (r *Repository) DeleteExpiredConversations(ctx context.Context) (int64, error) {
+	cmd, err := r.pool.Exec(ctx, `
+		DELETE FROM conversation_states WHERE expires_at <= CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, fmt.Errorf("error DeleteExpiredConversations: %w", err)
+	}
+	return cmd.RowsAffected(), nil
+}
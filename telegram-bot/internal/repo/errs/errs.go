@@ -7,4 +7,17 @@ var (
 	ErrPrizeNotFound        = errors.New("prize not found")
 	ErrUserAlreadyExists    = errors.New("user already exists")
 	ErrPhoneAlreadyExists   = errors.New("phone already exists")
+	ErrOutsideRedeemWindow  = errors.New("outside campaign redemption window")
+	ErrCodeMistyped         = errors.New("code check character mismatch")
+	ErrPrizeVoided          = errors.New("prize voided")
+	ErrPrizeExpired         = errors.New("prize expired")
+	ErrAlreadyActivated     = errors.New("prize already activated")
+	ErrNotActivated         = errors.New("prize not activated")
+	ErrReasonRequired       = errors.New("reason required")
+	ErrStoreNotFound        = errors.New("store not found")
+	ErrWrongStore           = errors.New("prize is not valid in this store")
+	ErrStaffNotFound        = errors.New("staff member not found")
+	ErrForbidden            = errors.New("not enough rights")
+	ErrUnknownSegment       = errors.New("unknown mailing segment")
+	ErrMailingNotFound      = errors.New("mailing not found or already started")
 )
@@ -0,0 +1,383 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"tgbot-bad-da-yo/internal/repo/errs"
+	"tgbot-bad-da-yo/model"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateMailing ставит рассылку в очередь. Получатели фиксируются при запуске, см. StartMailing
+func (r *Repository) CreateMailing(ctx context.Context, m model.Mailing) (model.Mailing, error) {
+	if m.Segment.Kind == "" {
+		m.Segment.Kind = model.SegmentAll
+	}
+	if _, _, err := segmentFilter(m.Segment, 1); err != nil {
+		return m, err
+	}
+
+	err := r.pool.QueryRow(ctx, `
+		INSERT INTO mailings (text, media_id, media_type, created_by, progress_chat_id, segment, scheduled_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7)
+		RETURNING id, status, created_at`,
+		m.Text, m.MediaID, m.MediaType, m.CreatedBy, m.ChatID, m.Segment, m.ScheduledAt).Scan(&m.ID, &m.Status, &m.CreatedAt)
+	if err != nil {
+		return m, fmt.Errorf("error CreateMailing: %w", err)
+	}
+	return m, nil
+}
+
+// StartMailing переводит рассылку в работу и при первом запуске фиксирует получателей -
+// пользователей аудитории, не заблокировавших бота. При возобновлении список не меняется
+func (r *Repository) StartMailing(ctx context.Context, m *model.Mailing) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error StartMailing begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx, `
+		UPDATE mailings SET status = 'running', started_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending'`, m.ID)
+	if err != nil {
+		return fmt.Errorf("error StartMailing: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		// Уже запущена до перезапуска бота или отменена, пока ее брали в аренду
+		var status string
+		err = tx.QueryRow(ctx, `SELECT status FROM mailings WHERE id = $1`, m.ID).Scan(&status)
+		if err != nil {
+			return fmt.Errorf("error StartMailing status: %w", err)
+		}
+		if status != model.MailingRunning {
+			return errs.ErrMailingNotFound
+		}
+		m.Status = model.MailingRunning
+		return nil
+	}
+
+	filter, args, err := segmentFilter(m.Segment, 2)
+	if err != nil {
+		return err
+	}
+	cmd, err = tx.Exec(ctx, `
+		INSERT INTO mailing_deliveries (mailing_id, telegram_id)
+		SELECT DISTINCT $1::BIGINT, u.telegram_id FROM users u
+		WHERE u.telegram_id IS NOT NULL AND u.blocked_at IS NULL AND `+filter,
+		append([]any{m.ID}, args...)...)
+	if err != nil {
+		return fmt.Errorf("error StartMailing recipients: %w", err)
+	}
+	total := int(cmd.RowsAffected())
+
+	_, err = tx.Exec(ctx, `UPDATE mailings SET total = $1 WHERE id = $2`, total, m.ID)
+	if err != nil {
+		return fmt.Errorf("error StartMailing total: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error StartMailing commit: %w", err)
+	}
+	m.Status = model.MailingRunning
+	m.Total = total
+	return nil
+}
+
+// NextScheduledAt возвращает время ближайшей отложенной рассылки; nil - таких нет
+func (r *Repository) NextScheduledAt(ctx context.Context) (*time.Time, error) {
+	var at *time.Time
+	err := r.pool.QueryRow(ctx, `
+		SELECT MIN(scheduled_at) FROM mailings
+		WHERE status = 'pending' AND scheduled_at IS NOT NULL`).Scan(&at)
+	if err != nil {
+		return nil, fmt.Errorf("error NextScheduledAt: %w", err)
+	}
+	return at, nil
+}
+
+// GetScheduledMailings возвращает отложенные рассылки, которые еще не начались
+func (r *Repository) GetScheduledMailings(ctx context.Context) ([]model.Mailing, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, text, COALESCE(media_type, ''), segment, created_by, scheduled_at, created_at
+		FROM mailings
+		WHERE status = 'pending' AND scheduled_at IS NOT NULL
+		ORDER BY scheduled_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("error query GetScheduledMailings: %w", err)
+	}
+	defer rows.Close()
+
+	var mailings []model.Mailing
+	for rows.Next() {
+		m := model.Mailing{Status: model.MailingPending}
+		if err := rows.Scan(&m.ID, &m.Text, &m.MediaType, &m.Segment, &m.CreatedBy, &m.ScheduledAt, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scan GetScheduledMailings: %w", err)
+		}
+		mailings = append(mailings, m)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error rows.Err - GetScheduledMailings: %w", err)
+	}
+	return mailings, nil
+}
+
+// CancelMailing отменяет рассылку, пока она не началась
+func (r *Repository) CancelMailing(ctx context.Context, id int64) error {
+	cmd, err := r.pool.Exec(ctx, `
+		UPDATE mailings SET status = 'cancelled', finished_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'pending'`, id)
+	if err != nil {
+		return fmt.Errorf("error CancelMailing: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrMailingNotFound
+	}
+	return nil
+}
+
+// CountSegment считает, сколько получателей будет у рассылки на аудиторию
+func (r *Repository) CountSegment(ctx context.Context, seg model.Segment) (int, error) {
+	filter, args, err := segmentFilter(seg, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = r.pool.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT u.telegram_id) FROM users u
+		WHERE u.telegram_id IS NOT NULL AND u.blocked_at IS NULL AND `+filter,
+		args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error CountSegment: %w", err)
+	}
+	return count, nil
+}
+
+// segmentFilter возвращает условие на пользователя u для аудитории; параметры нумеруются с firstArg
+func segmentFilter(seg model.Segment, firstArg int) (string, []any, error) {
+	arg := func(n int) string {
+		return fmt.Sprintf("$%d", firstArg+n)
+	}
+
+	switch seg.Kind {
+	case model.SegmentAll:
+		return "TRUE", nil, nil
+	case model.SegmentUnredeemed:
+		return `EXISTS (
+			SELECT 1 FROM prizes p
+			WHERE p.telegram_id = u.telegram_id AND p.used_at IS NULL AND p.voided_at IS NULL
+			  AND (p.expires_at IS NULL OR p.expires_at > CURRENT_TIMESTAMP))`, nil, nil
+	case model.SegmentRedeemed:
+		return `EXISTS (SELECT 1 FROM prizes p WHERE p.telegram_id = u.telegram_id AND p.used_at IS NOT NULL)`, nil, nil
+	case model.SegmentNoPhone:
+		return `COALESCE(u.phone, '') = ''`, nil, nil
+	case model.SegmentRegistered:
+		if seg.From == nil || seg.To == nil {
+			return "", nil, errs.ErrUnknownSegment
+		}
+		return "u.created_at >= " + arg(0) + " AND u.created_at < " + arg(1), []any{*seg.From, *seg.To}, nil
+	case model.SegmentCampaign:
+		return `EXISTS (SELECT 1 FROM prizes p WHERE p.telegram_id = u.telegram_id AND p.campaign_id = ` + arg(0) + `)`, []any{seg.ID}, nil
+	case model.SegmentPrize:
+		return `EXISTS (SELECT 1 FROM prizes p WHERE p.telegram_id = u.telegram_id AND p.catalog_id = ` + arg(0) + `)`, []any{seg.ID}, nil
+	default:
+		return "", nil, errs.ErrUnknownSegment
+	}
+}
+
+// GetCampaignOptions возвращает акции для выбора аудитории, новые первыми
+func (r *Repository) GetCampaignOptions(ctx context.Context) ([]model.SegmentOption, error) {
+	return r.segmentOptions(ctx, `SELECT id, name FROM campaigns ORDER BY id DESC`)
+}
+
+// GetPrizeOptions возвращает призы каталога для выбора аудитории
+func (r *Repository) GetPrizeOptions(ctx context.Context) ([]model.SegmentOption, error) {
+	return r.segmentOptions(ctx, `SELECT id, name FROM prize_catalog ORDER BY name`)
+}
+
+func (r *Repository) segmentOptions(ctx context.Context, query string) ([]model.SegmentOption, error) {
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error query segmentOptions: %w", err)
+	}
+	defer rows.Close()
+
+	var options []model.SegmentOption
+	for rows.Next() {
+		var o model.SegmentOption
+		if err := rows.Scan(&o.ID, &o.Name); err != nil {
+			return nil, fmt.Errorf("error scan segmentOptions: %w", err)
+		}
+		options = append(options, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error rows.Err - segmentOptions: %w", err)
+	}
+	return options, nil
+}
+
+// ClaimMailing берет в аренду рассылку, которую пора отправлять, и возвращает ее вместе с прогрессом:
+// сначала прерванную, затем самую старую из тех, чье время пришло. Рассылки в чужой непросроченной
+// аренде пропускаются, поэтому реплики бота не отправляют одну рассылку дважды; false - брать нечего
+func (r *Repository) ClaimMailing(ctx context.Context, owner string, lease time.Duration) (model.Mailing, bool, error) {
+	var m model.Mailing
+	var mediaID, mediaType *string
+	var messageID *int
+
+	err := r.pool.QueryRow(ctx, `
+		WITH claimed AS (
+			UPDATE mailings
+			SET locked_by = $1, locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2)
+			WHERE id = (
+				SELECT id FROM mailings
+				WHERE (status = 'running'
+				       OR (status = 'pending' AND (scheduled_at IS NULL OR scheduled_at <= CURRENT_TIMESTAMP)))
+				  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP OR locked_by = $1)
+				ORDER BY status = 'running' DESC, id
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT m.id, m.text, m.media_id, m.media_type, m.segment, m.status, m.created_by,
+		       m.progress_chat_id, m.progress_message_id, m.total, m.created_at,
+		       (SELECT COUNT(*) FROM mailing_deliveries d WHERE d.mailing_id = m.id AND d.status = 'sent'),
+		       (SELECT COUNT(*) FROM mailing_deliveries d WHERE d.mailing_id = m.id AND d.status = 'failed')
+		FROM claimed m`,
+		owner, lease.Seconds()).Scan(
+		&m.ID, &m.Text, &mediaID, &mediaType, &m.Segment, &m.Status, &m.CreatedBy,
+		&m.ChatID, &messageID, &m.Total, &m.CreatedAt,
+		&m.Sent, &m.Failed,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m, false, nil
+	}
+	if err != nil {
+		return m, false, fmt.Errorf("error ClaimMailing: %w", err)
+	}
+
+	if mediaID != nil {
+		m.MediaID = *mediaID
+	}
+	if mediaType != nil {
+		m.MediaType = *mediaType
+	}
+	if messageID != nil {
+		m.MessageID = *messageID
+	}
+	return m, true, nil
+}
+
+// ExtendMailingLease продлевает аренду рассылки; false - аренду перехватила другая реплика
+func (r *Repository) ExtendMailingLease(ctx context.Context, id int64, owner string, lease time.Duration) (bool, error) {
+	cmd, err := r.pool.Exec(ctx, `
+		UPDATE mailings SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		WHERE id = $1 AND locked_by = $2`,
+		id, owner, lease.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("error ExtendMailingLease: %w", err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// ReleaseMailing снимает аренду, чтобы рассылку сразу могла продолжить другая реплика
+func (r *Repository) ReleaseMailing(ctx context.Context, id int64, owner string) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE mailings SET locked_by = NULL, locked_until = NULL
+		WHERE id = $1 AND locked_by = $2`, id, owner)
+	if err != nil {
+		return fmt.Errorf("error ReleaseMailing: %w", err)
+	}
+	return nil
+}
+
+// SetMailingMessage запоминает сообщение с прогрессом рассылки
+func (r *Repository) SetMailingMessage(ctx context.Context, id int64, messageID int) error {
+	_, err := r.pool.Exec(ctx, `UPDATE mailings SET progress_message_id = $1 WHERE id = $2`, messageID, id)
+	if err != nil {
+		return fmt.Errorf("error SetMailingMessage: %w", err)
+	}
+	return nil
+}
+
+// FinishMailing завершает рассылку, если у нее не осталось неотправленных получателей.
+// false - часть получателей еще в заявке другой реплики
+func (r *Repository) FinishMailing(ctx context.Context, id int64) (bool, error) {
+	cmd, err := r.pool.Exec(ctx, `
+		UPDATE mailings SET status = 'done', finished_at = CURRENT_TIMESTAMP,
+		                    locked_by = NULL, locked_until = NULL
+		WHERE id = $1 AND status = 'running'
+		  AND NOT EXISTS (SELECT 1 FROM mailing_deliveries WHERE mailing_id = $1 AND status = 'pending')`, id)
+	if err != nil {
+		return false, fmt.Errorf("error FinishMailing: %w", err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// ClaimRecipients берет в отправку следующую пачку получателей, которым рассылка еще не отправлялась.
+// Строки, которые прямо сейчас берет другая реплика, и непросроченные чужие заявки пропускаются
+func (r *Repository) ClaimRecipients(ctx context.Context, mailingID int64, limit int, lease time.Duration) ([]int64, error) {
+	rows, err := r.pool.Query(ctx, `
+		UPDATE mailing_deliveries
+		SET claimed_until = CURRENT_TIMESTAMP + make_interval(secs => $3)
+		WHERE mailing_id = $1 AND telegram_id IN (
+			SELECT telegram_id FROM mailing_deliveries
+			WHERE mailing_id = $1 AND status = 'pending'
+			  AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+			ORDER BY telegram_id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING telegram_id`, mailingID, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("error query ClaimRecipients: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scan ClaimRecipients: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error rows.Err - ClaimRecipients: %w", err)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// ReleaseRecipients возвращает в очередь взятых, но не обработанных получателей
+func (r *Repository) ReleaseRecipients(ctx context.Context, mailingID int64, telegramIDs []int64) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE mailing_deliveries SET claimed_until = NULL
+		WHERE mailing_id = $1 AND telegram_id = ANY($2) AND status = 'pending'`,
+		mailingID, telegramIDs)
+	if err != nil {
+		return fmt.Errorf("error ReleaseRecipients: %w", err)
+	}
+	return nil
+}
+
+// SetDeliveryStatus записывает результат отправки рассылки получателю
+func (r *Repository) SetDeliveryStatus(ctx context.Context, mailingID, telegramID int64, status, errText string) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE mailing_deliveries
+		SET status = $1, error = NULLIF($2, ''), sent_at = CURRENT_TIMESTAMP, claimed_until = NULL
+		WHERE mailing_id = $3 AND telegram_id = $4 AND status = 'pending'`,
+		status, errText, mailingID, telegramID)
+	if err != nil {
+		return fmt.Errorf("error SetDeliveryStatus: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"tgbot-bad-da-yo/internal/repo/errs"
+	"tgbot-bad-da-yo/model"
+	"time"
+)
+
+func TestSegmentFilter(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 8, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		seg      model.Segment
+		firstArg int
+		contains []string
+		args     []any
+		wantErr  bool
+	}{
+		{name: "all", seg: model.Segment{Kind: model.SegmentAll}, firstArg: 1, contains: []string{"TRUE"}},
+		{name: "unredeemed", seg: model.Segment{Kind: model.SegmentUnredeemed}, firstArg: 1,
+			contains: []string{"p.used_at IS NULL", "p.voided_at IS NULL", "p.expires_at"}},
+		{name: "redeemed", seg: model.Segment{Kind: model.SegmentRedeemed}, firstArg: 1, contains: []string{"p.used_at IS NOT NULL"}},
+		{name: "no phone", seg: model.Segment{Kind: model.SegmentNoPhone}, firstArg: 1, contains: []string{"u.phone"}},
+		{name: "registered", seg: model.Segment{Kind: model.SegmentRegistered, From: &from, To: &to}, firstArg: 1,
+			contains: []string{"u.created_at >= $1", "u.created_at < $2"}, args: []any{from, to}},
+		{name: "registered after other params", seg: model.Segment{Kind: model.SegmentRegistered, From: &from, To: &to}, firstArg: 3,
+			contains: []string{"u.created_at >= $3", "u.created_at < $4"}, args: []any{from, to}},
+		{name: "campaign", seg: model.Segment{Kind: model.SegmentCampaign, ID: 7}, firstArg: 2,
+			contains: []string{"p.campaign_id = $2"}, args: []any{int64(7)}},
+		{name: "prize", seg: model.Segment{Kind: model.SegmentPrize, ID: 3}, firstArg: 1,
+			contains: []string{"p.catalog_id = $1"}, args: []any{int64(3)}},
+		{name: "registered without period", seg: model.Segment{Kind: model.SegmentRegistered, From: &from}, wantErr: true},
+		{name: "unknown kind", seg: model.Segment{Kind: "vip"}, wantErr: true},
+		{name: "empty kind", seg: model.Segment{}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, args, err := segmentFilter(tt.seg, tt.firstArg)
+			if tt.wantErr {
+				if !errors.Is(err, errs.ErrUnknownSegment) {
+					t.Fatalf("segmentFilter(%+v) error = %v, want ErrUnknownSegment", tt.seg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("segmentFilter(%+v) error = %v", tt.seg, err)
+			}
+			for _, part := range tt.contains {
+				if !strings.Contains(filter, part) {
+					t.Errorf("segmentFilter(%+v) = %q, want it to contain %q", tt.seg, filter, part)
+				}
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Fatalf("segmentFilter(%+v) args = %v, want %v", tt.seg, args, tt.args)
+			}
+		})
+	}
+}
@@ -4,12 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 	"tgbot-bad-da-yo/internal/repo/errs"
 	"tgbot-bad-da-yo/model"
 	"time"
-	"unicode"
 
+	"github.com/berduk-dev/promocode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -25,37 +24,25 @@ func New(pool *pgxpool.Pool) Repository {
 	}
 }
 
-func sanitizeCode(s string) string {
-	s = strings.TrimSpace(s)
-	s = strings.ToUpper(s)
-	// заменим похожие кириллические на латинские (частый баг в ТГ)
-	repl := map[rune]rune{
-		'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'S', 'Т': 'T', 'У': 'Y', 'Х': 'X',
-		'а': 'A', 'е': 'E', 'о': 'O', 'р': 'P', 'с': 'S', 'х': 'X',
-	}
-	out := make([]rune, 0, len(s))
-	for _, r := range s {
-		if rr, ok := repl[r]; ok {
-			out = append(out, rr)
-		} else {
-			// выбросим невидимые символы (ZWSP и т.п.)
-			if unicode.IsSpace(r) && r != ' ' {
-				continue
-			}
-			out = append(out, r)
-		}
-	}
-	return string(out)
+func scanPrize(row pgx.Row, prize *model.Prize) error {
+	return row.Scan(
+		&prize.ID, &prize.Code, &prize.Prize, &prize.CreatedAt, &prize.UsedAt, &prize.VoidedAt, &prize.VoidReason, &prize.ExpiresAt,
+		&prize.Campaign.ID, &prize.Campaign.Name, &prize.Campaign.RedeemStartsAt, &prize.Campaign.RedeemEndsAt, &prize.Campaign.Address,
+		&prize.StoreIDs,
+	)
 }
 
 func (r *Repository) GetPrizeByUserID(ctx context.Context, userID int64) (*model.Prize, error) {
 	var prize model.Prize
 	row := r.pool.QueryRow(ctx, `
-        SELECT id, code, prize, created_at, used_at
-        FROM prizes
-        WHERE telegram_id = $1`, userID)
-
-	err := row.Scan(&prize.ID, &prize.Code, &prize.Prize, &prize.CreatedAt, &prize.UsedAt)
+        SELECT p.id, p.code, p.prize, p.created_at, p.used_at, p.voided_at, p.void_reason, p.expires_at,
+               c.id, c.name, c.redeem_starts_at, c.redeem_ends_at, c.address,
+               ARRAY(SELECT s.store_id::bigint FROM prize_catalog_stores s WHERE s.catalog_id = p.catalog_id ORDER BY s.store_id)
+        FROM prizes p
+        JOIN campaigns c ON c.id = p.campaign_id
+        WHERE p.telegram_id = $1`, userID)
+
+	err := scanPrize(row, &prize)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
 	}
@@ -66,15 +53,18 @@ func (r *Repository) GetPrizeByUserID(ctx context.Context, userID int64) (*model
 }
 
 func (r *Repository) GetPrizeByCode(ctx context.Context, code string) (model.Prize, error) {
-	code = sanitizeCode(code)
+	code = promocode.Normalize(code)
 
 	var prize model.Prize
 	row := r.pool.QueryRow(ctx, `
-        SELECT id, code, prize, created_at, used_at
-        FROM prizes
-        WHERE code = $1`, code)
-
-	err := row.Scan(&prize.ID, &prize.Code, &prize.Prize, &prize.CreatedAt, &prize.UsedAt)
+        SELECT p.id, p.code, p.prize, p.created_at, p.used_at, p.voided_at, p.void_reason, p.expires_at,
+               c.id, c.name, c.redeem_starts_at, c.redeem_ends_at, c.address,
+               ARRAY(SELECT s.store_id::bigint FROM prize_catalog_stores s WHERE s.catalog_id = p.catalog_id ORDER BY s.store_id)
+        FROM prizes p
+        JOIN campaigns c ON c.id = p.campaign_id
+        WHERE p.code = $1`, code)
+
+	err := scanPrize(row, &prize)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return model.Prize{}, pgx.ErrNoRows
 	}
@@ -84,18 +74,216 @@ func (r *Repository) GetPrizeByCode(ctx context.Context, code string) (model.Pri
 	return prize, nil
 }
 
-func (r *Repository) ActivateCode(ctx context.Context, code string) error {
-	now := time.Now().UTC().Add(3 * time.Hour) // МСК
-	_, err := r.pool.Exec(ctx, `
-		UPDATE prizes SET used_at = $1 WHERE code = $2`,
-		now, code)
+// ActivateCode погашает код и в той же транзакции пишет успешную попытку в журнал.
+// Погашается только еще не активированный, не аннулированный и не просроченный код: два одновременных нажатия
+// не перезапишут друг друга, а код, аннулированный после проверки в сервисе, не будет погашен
+func (r *Repository) ActivateCode(ctx context.Context, code string, actor model.RedemptionActor) error {
+	now := time.Now().UTC()
 
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error ActivateCode begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var prizeID int64
+	err = tx.QueryRow(ctx, `
+		UPDATE prizes SET used_at = $1
+		WHERE code = $2 AND used_at IS NULL AND voided_at IS NULL AND (expires_at IS NULL OR expires_at > $1)
+		RETURNING id`,
+		now, code).Scan(&prizeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r.prizeUsageError(ctx, code, errs.ErrAlreadyActivated)
+	}
 	if err != nil {
 		return fmt.Errorf("error ActivateCode: %w", err)
 	}
+
+	err = insertRedemption(ctx, tx, &prizeID, code, actor, model.RedemptionActivated, "", now)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error ActivateCode commit: %w", err)
+	}
+	return nil
+}
+
+// UndoActivation снимает активацию кода и записывает в журнал, кто и почему ее отменил.
+// Отменить активацию можно только в магазине, где код погасили; строка кода блокируется,
+// чтобы активация и отмена не прошли одновременно
+func (r *Repository) UndoActivation(ctx context.Context, code string, actor model.RedemptionActor, reason string) error {
+	now := time.Now().UTC()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error UndoActivation begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		prizeID int64
+		used    bool
+		storeID *int64
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT p.id, p.used_at IS NOT NULL, (`+activationStoreQuery+`)
+		FROM prizes p
+		WHERE p.code = $1
+		FOR UPDATE OF p`,
+		code, model.RedemptionActivated).Scan(&prizeID, &used, &storeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errs.ErrPrizeNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error UndoActivation select: %w", err)
+	}
+	if !used {
+		return errs.ErrNotActivated
+	}
+	if storeID != nil && *storeID != actor.StoreID {
+		return errs.ErrWrongStore
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE prizes SET used_at = NULL WHERE id = $1`, prizeID); err != nil {
+		return fmt.Errorf("error UndoActivation: %w", err)
+	}
+
+	err = insertRedemption(ctx, tx, &prizeID, code, actor, model.RedemptionUndone, reason, now)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error UndoActivation commit: %w", err)
+	}
 	return nil
 }
 
+// Магазин последней успешной активации кода p; NULL - код погашен до появления магазинов
+const activationStoreQuery = `
+	SELECT r.store_id FROM redemptions r
+	WHERE r.prize_id = p.id AND r.result = $2
+	ORDER BY r.created_at DESC, r.id DESC
+	LIMIT 1`
+
+// GetActivationStoreID возвращает магазин, где код был погашен; 0 - магазин неизвестен
+func (r *Repository) GetActivationStoreID(ctx context.Context, code string) (int64, error) {
+	var storeID *int64
+	err := r.pool.QueryRow(ctx, `
+		SELECT (`+activationStoreQuery+`)
+		FROM prizes p
+		WHERE p.code = $1`,
+		code, model.RedemptionActivated).Scan(&storeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errs.ErrPrizeNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error GetActivationStoreID: %w", err)
+	}
+	if storeID == nil {
+		return 0, nil
+	}
+	return *storeID, nil
+}
+
+// Условный UPDATE ничего не изменил: код не существует, уже в нужном состоянии
+// или, если он не активирован, успел истечь или быть аннулированным
+func (r *Repository) prizeUsageError(ctx context.Context, code string, stateErr error) error {
+	var used, expired, voided bool
+	err := r.pool.QueryRow(ctx, `
+		SELECT used_at IS NOT NULL,
+		       COALESCE(void_reason = $2, false) OR COALESCE(expires_at <= now(), false),
+		       voided_at IS NOT NULL
+		FROM prizes WHERE code = $1`,
+		code, model.VoidReasonExpired).Scan(&used, &expired, &voided)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errs.ErrPrizeNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error checking prize state: %w", err)
+	}
+
+	if errors.Is(stateErr, errs.ErrAlreadyActivated) && !used {
+		switch {
+		case expired:
+			return errs.ErrPrizeExpired
+		case voided:
+			return errs.ErrPrizeVoided
+		}
+	}
+	return stateErr
+}
+
+// AddRedemption пишет в журнал отклоненную попытку погашения
+func (r *Repository) AddRedemption(ctx context.Context, prizeID *int64, code string, actor model.RedemptionActor, result string) error {
+	now := time.Now().UTC()
+	return insertRedemption(ctx, r.pool, prizeID, code, actor, result, "", now)
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func insertRedemption(ctx context.Context, db execer, prizeID *int64, code string, actor model.RedemptionActor, result, reason string, at time.Time) error {
+	var username, reasonArg *string
+	if actor.Username != "" {
+		username = &actor.Username
+	}
+	if reason != "" {
+		reasonArg = &reason
+	}
+	var storeID *int64
+	if actor.StoreID != 0 {
+		storeID = &actor.StoreID
+	}
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO redemptions (prize_id, code, actor_telegram_id, actor_username, chat_id, message_id, result, reason, store_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		prizeID, code, actor.TelegramID, username, actor.ChatID, actor.MessageID, result, reasonArg, storeID, at)
+	if err != nil {
+		return fmt.Errorf("error insertRedemption: %w", err)
+	}
+	return nil
+}
+
+// GetRedemptions возвращает журнал попыток погашения кода в хронологическом порядке
+func (r *Repository) GetRedemptions(ctx context.Context, code string) ([]model.Redemption, error) {
+	code = promocode.Normalize(code)
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT r.id, r.prize_id, r.code, r.actor_telegram_id, COALESCE(r.actor_username, ''), r.chat_id,
+		       COALESCE(r.message_id, 0), r.result, COALESCE(r.reason, ''),
+		       COALESCE(r.store_id, 0), COALESCE(s.name, ''), r.created_at
+		FROM redemptions r
+		LEFT JOIN stores s ON s.id = r.store_id
+		WHERE r.code = $1
+		ORDER BY r.created_at, r.id`, code)
+	if err != nil {
+		return nil, fmt.Errorf("error query GetRedemptions: %w", err)
+	}
+	defer rows.Close()
+
+	var redemptions []model.Redemption
+	for rows.Next() {
+		var rd model.Redemption
+		err := rows.Scan(&rd.ID, &rd.PrizeID, &rd.Code, &rd.Actor.TelegramID, &rd.Actor.Username, &rd.Actor.ChatID,
+			&rd.Actor.MessageID, &rd.Result, &rd.Reason, &rd.Actor.StoreID, &rd.StoreName, &rd.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scan GetRedemptions: %w", err)
+		}
+		redemptions = append(redemptions, rd)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error rows.Err - GetRedemptions: %w", err)
+	}
+
+	return redemptions, nil
+}
+
 func (r *Repository) CreateUser(ctx context.Context, userID int64) error {
 	_, err := r.pool.Exec(ctx, `
 		INSERT INTO users (telegram_id) 
@@ -115,8 +303,9 @@ func (r *Repository) CreateUser(ctx context.Context, userID int64) error {
 	return nil
 }
 
+// GetTelegramIDs возвращает пользователей, которым бот может писать: заблокировавшие бота исключены
 func (r *Repository) GetTelegramIDs(ctx context.Context) ([]int64, error) {
-	rows, err := r.pool.Query(ctx, `SELECT telegram_id FROM users WHERE telegram_id IS NOT NULL`)
+	rows, err := r.pool.Query(ctx, `SELECT telegram_id FROM users WHERE telegram_id IS NOT NULL AND blocked_at IS NULL`)
 	if err != nil {
 		return nil, fmt.Errorf("error query GetTelegramIDs: %w", err)
 	}
@@ -138,24 +327,57 @@ func (r *Repository) GetTelegramIDs(ctx context.Context) ([]int64, error) {
 	return telegramIDs, nil
 }
 
-func (r *Repository) AddTelegramIdIntoPrize(ctx context.Context, telegramID int64, code string) error {
+// MarkUserBlocked отмечает, что пользователь заблокировал бота или удалил аккаунт
+func (r *Repository) MarkUserBlocked(ctx context.Context, telegramID int64) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE users SET blocked_at = CURRENT_TIMESTAMP
+		WHERE telegram_id = $1 AND blocked_at IS NULL`, telegramID)
+	if err != nil {
+		return fmt.Errorf("error MarkUserBlocked: %w", err)
+	}
+	return nil
+}
+
+// UnblockUser снимает отметку о блокировке, когда пользователь снова пишет боту
+func (r *Repository) UnblockUser(ctx context.Context, telegramID int64) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE users SET blocked_at = NULL
+		WHERE telegram_id = $1 AND blocked_at IS NOT NULL`, telegramID)
+	if err != nil {
+		return fmt.Errorf("error UnblockUser: %w", err)
+	}
+	return nil
+}
+
+// AddTelegramIdIntoPrize привязывает код к пользователю и продлевает срок кода на погашение:
+// redeemTTL с начала окна погашения акции (0 - до конца акции)
+func (r *Repository) AddTelegramIdIntoPrize(ctx context.Context, telegramID int64, code string, redeemTTL time.Duration) error {
 	cmd, err := r.pool.Exec(ctx, `
-        UPDATE prizes
-        SET telegram_id = $1
-        WHERE code = $2 AND telegram_id IS NULL
-    `, telegramID, code)
+        UPDATE prizes p
+        SET telegram_id = $1,
+            expires_at = CASE WHEN $3::float8 > 0
+                              THEN LEAST(GREATEST(CURRENT_TIMESTAMP, c.redeem_starts_at) + make_interval(secs => $3), c.redeem_ends_at)
+                              ELSE c.redeem_ends_at
+                         END
+        FROM campaigns c
+        WHERE c.id = p.campaign_id
+          AND p.code = $2 AND p.telegram_id IS NULL AND p.voided_at IS NULL
+          AND (p.expires_at IS NULL OR p.expires_at > CURRENT_TIMESTAMP)
+    `, telegramID, code, redeemTTL.Seconds())
 
 	if err != nil {
 		return fmt.Errorf("error AddTelegramIdIntoPrize: %w", err)
 	}
 
-	// Ничего не обновилось → две причины
+	// Ничего не обновилось → выясняем причину
 	if cmd.RowsAffected() == 0 {
-		// проверим, существует ли приз
-		var exists bool
+		// проверим, существует ли приз (аннулированный вручную считаем несуществующим)
+		var exists, expired bool
 		err := r.pool.QueryRow(ctx, `
-            SELECT EXISTS(SELECT 1 FROM prizes WHERE code = $1)
-        `, code).Scan(&exists)
+            SELECT EXISTS(SELECT 1 FROM prizes WHERE code = $1 AND (voided_at IS NULL OR void_reason = $2)),
+                   EXISTS(SELECT 1 FROM prizes WHERE code = $1 AND telegram_id IS NULL
+                          AND (void_reason = $2 OR expires_at <= CURRENT_TIMESTAMP))
+        `, code, model.VoidReasonExpired).Scan(&exists, &expired)
 
 		if err != nil {
 			return fmt.Errorf("error checking prize existence: %w", err)
@@ -164,6 +386,9 @@ func (r *Repository) AddTelegramIdIntoPrize(ctx context.Context, telegramID int6
 		if !exists {
 			return errs.ErrPrizeNotFound
 		}
+		if expired {
+			return errs.ErrPrizeExpired
+		}
 
 		return errs.ErrTelegramIDAlreadySet
 	}
@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tgbot-bad-da-yo/internal/repo/errs"
+	"tgbot-bad-da-yo/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetStaffRole возвращает роль пользователя или пустую, если он не сотрудник
+func (r *Repository) GetStaffRole(ctx context.Context, telegramID int64) (model.Role, error) {
+	var role model.Role
+	err := r.pool.QueryRow(ctx, `SELECT role FROM staff WHERE telegram_id = $1`, telegramID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error GetStaffRole: %w", err)
+	}
+	return role, nil
+}
+
+// BindStaffMember привязывает telegram_id к сотруднику, добавленному по username и еще не привязанному.
+// Пользователь, у которого уже есть роль, чужую запись не забирает
+func (r *Repository) BindStaffMember(ctx context.Context, telegramID int64, username string) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE staff
+		SET telegram_id = $1
+		WHERE telegram_id IS NULL AND username = $2
+		  AND NOT EXISTS (SELECT 1 FROM staff WHERE telegram_id = $1)`,
+		telegramID, username)
+	if err != nil {
+		return fmt.Errorf("error BindStaffMember: %w", err)
+	}
+	return nil
+}
+
+// GetStaffMember ищет сотрудника по telegram_id или username
+func (r *Repository) GetStaffMember(ctx context.Context, target model.StaffMember) (model.StaffMember, error) {
+	var member model.StaffMember
+	err := r.pool.QueryRow(ctx, `
+		SELECT telegram_id, username, role, created_at
+		FROM staff
+		WHERE telegram_id = $1 OR username = $2
+		ORDER BY id
+		LIMIT 1`, target.TelegramID, target.Username,
+	).Scan(&member.TelegramID, &member.Username, &member.Role, &member.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.StaffMember{}, errs.ErrStaffNotFound
+	}
+	if err != nil {
+		return model.StaffMember{}, fmt.Errorf("error GetStaffMember: %w", err)
+	}
+	return member, nil
+}
+
+// SaveStaffMember добавляет сотрудника или меняет роль уже добавленного
+func (r *Repository) SaveStaffMember(ctx context.Context, member model.StaffMember, addedBy int64) error {
+	conflict := "telegram_id"
+	if member.TelegramID == nil {
+		conflict = "username"
+	}
+
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO staff (telegram_id, username, role, added_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (`+conflict+`) DO UPDATE SET role = EXCLUDED.role`,
+		member.TelegramID, member.Username, member.Role, addedBy)
+	if err != nil {
+		return fmt.Errorf("error SaveStaffMember: %w", err)
+	}
+	return nil
+}
+
+// EnsureStaffMember добавляет сотрудника, только если его еще нет (роли из переменных окружения)
+func (r *Repository) EnsureStaffMember(ctx context.Context, telegramID int64, role model.Role) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO staff (telegram_id, role)
+		VALUES ($1, $2)
+		ON CONFLICT (telegram_id) DO NOTHING`, telegramID, role)
+	if err != nil {
+		return fmt.Errorf("error EnsureStaffMember: %w", err)
+	}
+	return nil
+}
+
+// RemoveStaffMember удаляет сотрудника по telegram_id или username
+func (r *Repository) RemoveStaffMember(ctx context.Context, target model.StaffMember) error {
+	cmd, err := r.pool.Exec(ctx, `
+		DELETE FROM staff WHERE telegram_id = $1 OR username = $2`,
+		target.TelegramID, target.Username)
+	if err != nil {
+		return fmt.Errorf("error RemoveStaffMember: %w", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrStaffNotFound
+	}
+	return nil
+}
+
+// ListStaff возвращает всех сотрудников
+func (r *Repository) ListStaff(ctx context.Context) ([]model.StaffMember, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT telegram_id, username, role, created_at
+		FROM staff
+		ORDER BY role, id`)
+	if err != nil {
+		return nil, fmt.Errorf("error query ListStaff: %w", err)
+	}
+	defer rows.Close()
+
+	var members []model.StaffMember
+	for rows.Next() {
+		var member model.StaffMember
+		if err := rows.Scan(&member.TelegramID, &member.Username, &member.Role, &member.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scan ListStaff: %w", err)
+		}
+		members = append(members, member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error rows.Err - ListStaff: %w", err)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,75 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tgbot-bad-da-yo/internal/repo/errs"
+	"tgbot-bad-da-yo/model"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const storeColumns = `id, name, address, hours, timezone, cashier_chat_id`
+
+func scanStore(row pgx.Row, store *model.Store) error {
+	return row.Scan(&store.ID, &store.Name, &store.Address, &store.Hours, &store.Timezone, &store.CashierChatID)
+}
+
+// GetStoreByChatID находит магазин по чату его кассиров
+func (r *Repository) GetStoreByChatID(ctx context.Context, chatID int64) (model.Store, error) {
+	var store model.Store
+	err := scanStore(r.pool.QueryRow(ctx, `
+		SELECT `+storeColumns+`
+		FROM stores
+		WHERE cashier_chat_id = $1`, chatID), &store)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.Store{}, errs.ErrStoreNotFound
+	}
+	if err != nil {
+		return model.Store{}, fmt.Errorf("error GetStoreByChatID: %w", err)
+	}
+	return store, nil
+}
+
+// GetStores возвращает магазины по списку id, а при пустом списке - все
+func (r *Repository) GetStores(ctx context.Context, ids []int64) ([]model.Store, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+storeColumns+`
+		FROM stores
+		WHERE COALESCE(cardinality($1::bigint[]), 0) = 0 OR id = ANY($1::bigint[])
+		ORDER BY id`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error query GetStores: %w", err)
+	}
+	defer rows.Close()
+
+	var stores []model.Store
+	for rows.Next() {
+		var store model.Store
+		if err := scanStore(rows, &store); err != nil {
+			return nil, fmt.Errorf("error scan GetStores: %w", err)
+		}
+		stores = append(stores, store)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error rows.Err - GetStores: %w", err)
+	}
+
+	return stores, nil
+}
+
+// BindLegacyCashierChat привязывает старый единственный чат кассиров к первому магазину,
+// пока ни у одного магазина нет своего чата
+func (r *Repository) BindLegacyCashierChat(ctx context.Context, chatID int64) (bool, error) {
+	cmd, err := r.pool.Exec(ctx, `
+		UPDATE stores
+		SET cashier_chat_id = $1
+		WHERE id = (SELECT MIN(id) FROM stores)
+		  AND NOT EXISTS (SELECT 1 FROM stores WHERE cashier_chat_id IS NOT NULL)`, chatID)
+	if err != nil {
+		return false, fmt.Errorf("error BindLegacyCashierChat: %w", err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"tgbot-bad-da-yo/model"
+	"time"
+)
+
+// Сколько живет каждый шаг диалога, если пользователь его бросил
+var conversationTTL = map[string]time.Duration{
+	model.StepClaimPhone:   24 * time.Hour,
+	model.StepMailCompose:  time.Hour,
+	model.StepMailSegment:  time.Hour,
+	model.StepMailDates:    time.Hour,
+	model.StepMailConfirm:  time.Hour,
+	model.StepMailSchedule: time.Hour,
+	model.StepUndoReason:   15 * time.Minute,
+}
+
+const defaultConversationTTL = time.Hour
+
+// GetConversation возвращает текущий диалог пользователя в чате; пустой Step - диалога нет
+func (s *Service) GetConversation(ctx context.Context, userID, chatID int64) (model.Conversation, error) {
+	conv, err := s.repo.GetConversation(ctx, userID, chatID)
+	if err != nil {
+		return conv, fmt.Errorf("error repo.GetConversation: %w", err)
+	}
+
+	return conv, nil
+}
+
+// SaveConversation переводит диалог на новый шаг
+func (s *Service) SaveConversation(ctx context.Context, conv model.Conversation) error {
+	ttl, ok := conversationTTL[conv.Step]
+	if !ok {
+		ttl = defaultConversationTTL
+	}
+
+	err := s.repo.SaveConversation(ctx, conv, ttl)
+	if err != nil {
+		return fmt.Errorf("error repo.SaveConversation: %w", err)
+	}
+
+	return nil
+}
+
+// TakeConversation забирает диалог на указанном шаге, чтобы обработать его ровно один раз
+func (s *Service) TakeConversation(ctx context.Context, userID, chatID int64, step string) (model.Conversation, bool, error) {
+	conv, ok, err := s.repo.TakeConversation(ctx, userID, chatID, step)
+	if err != nil {
+		return conv, false, fmt.Errorf("error repo.TakeConversation: %w", err)
+	}
+
+	return conv, ok, nil
+}
+
+// EndConversation завершает диалог пользователя в чате
+func (s *Service) EndConversation(ctx context.Context, userID, chatID int64) error {
+	err := s.repo.DeleteConversation(ctx, userID, chatID)
+	if err != nil {
+		return fmt.Errorf("error repo.DeleteConversation: %w", err)
+	}
+
+	return nil
+}
+
+// RunConversationCleanup периодически удаляет брошенные диалоги, пока не отменен ctx
+func (s *Service) RunConversationCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.repo.DeleteExpiredConversations(ctx)
+		if err != nil {
+			log.Println("error repo.DeleteExpiredConversations:", err)
+		} else if deleted > 0 {
+			log.Printf("удалено брошенных диалогов: %d", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"tgbot-bad-da-yo/internal/repo/errs"
+	"tgbot-bad-da-yo/model"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// Сколько получателей рассылки обрабатывается между обновлениями прогресса
+	mailingBatchSize = 100
+	// Аренда рассылки и заявки на пачку получателей: продлевается после каждой пачки,
+	// а после падения реплики истекает, и рассылку подхватывает другая
+	mailingLease = 5 * time.Minute
+)
+
+// CreateMailing ставит рассылку в очередь и будит фоновую отправку, чтобы та учла ее время
+func (s *Service) CreateMailing(ctx context.Context, m model.Mailing) (model.Mailing, error) {
+	m, err := s.repo.CreateMailing(ctx, m)
+	if err != nil {
+		return m, fmt.Errorf("error repo.CreateMailing: %w", err)
+	}
+
+	select {
+	case s.mailingWake <- struct{}{}:
+	default:
+	}
+	return m, nil
+}
+
+// GetScheduledMailings возвращает отложенные рассылки, которые еще можно отменить
+func (s *Service) GetScheduledMailings(ctx context.Context) ([]model.Mailing, error) {
+	mailings, err := s.repo.GetScheduledMailings(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.GetScheduledMailings: %w", err)
+	}
+
+	return mailings, nil
+}
+
+// CancelMailing отменяет рассылку, которая еще не началась
+func (s *Service) CancelMailing(ctx context.Context, id int64) error {
+	err := s.repo.CancelMailing(ctx, id)
+	if err != nil {
+		return fmt.Errorf("error repo.CancelMailing: %w", err)
+	}
+
+	return nil
+}
+
+// CountSegment считает получателей рассылки на аудиторию
+func (s *Service) CountSegment(ctx context.Context, seg model.Segment) (int, error) {
+	count, err := s.repo.CountSegment(ctx, seg)
+	if err != nil {
+		return 0, fmt.Errorf("error repo.CountSegment: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetCampaignOptions возвращает акции, по участникам которых можно сделать рассылку
+func (s *Service) GetCampaignOptions(ctx context.Context) ([]model.SegmentOption, error) {
+	options, err := s.repo.GetCampaignOptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.GetCampaignOptions: %w", err)
+	}
+
+	return options, nil
+}
+
+// GetPrizeOptions возвращает призы каталога, по получателям которых можно сделать рассылку
+func (s *Service) GetPrizeOptions(ctx context.Context) ([]model.SegmentOption, error) {
+	options, err := s.repo.GetPrizeOptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.GetPrizeOptions: %w", err)
+	}
+
+	return options, nil
+}
+
+// RunMailings отправляет рассылки в фоне, пока не отменен ctx. Отложенные рассылки стартуют в свое
+// время, незавершенные продолжаются с первого неотправленного получателя - в том числе после
+// перезапуска бота, потому что очередь и расписание хранятся в базе
+func (s *Service) RunMailings(ctx context.Context, interval time.Duration) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		s.sendMailings(ctx)
+
+		timer.Reset(s.nextMailingCheck(ctx, interval))
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.mailingWake:
+		case <-timer.C:
+		}
+	}
+}
+
+// nextMailingCheck - сколько ждать до следующей проверки очереди: до ближайшей отложенной рассылки,
+// но не дольше interval
+func (s *Service) nextMailingCheck(ctx context.Context, interval time.Duration) time.Duration {
+	at, err := s.repo.NextScheduledAt(ctx)
+	if err != nil {
+		log.Println("error repo.NextScheduledAt:", err)
+		return interval
+	}
+	if at == nil {
+		return interval
+	}
+
+	return min(max(time.Until(*at), 0), interval)
+}
+
+// sendMailings отправляет рассылки по очереди, пока они не закончатся. Каждую рассылку воркер
+// берет в аренду, чтобы при нескольких репликах бота она не ушла дважды
+func (s *Service) sendMailings(ctx context.Context) {
+	// Аренду снимаем и при остановке бота, чтобы другая реплика продолжила сразу
+	saveCtx := context.WithoutCancel(ctx)
+
+	for ctx.Err() == nil {
+		m, ok, err := s.repo.ClaimMailing(ctx, s.workerID, mailingLease)
+		if err != nil {
+			log.Println("error repo.ClaimMailing:", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		finished, err := s.sendMailing(ctx, m)
+		if err := s.repo.ReleaseMailing(saveCtx, m.ID, s.workerID); err != nil {
+			log.Println("error repo.ReleaseMailing:", err)
+		}
+		if err != nil {
+			log.Printf("error sendMailing %d: %v", m.ID, err)
+			return
+		}
+		if !finished {
+			// Остаток в заявке другой реплики или аренду перехватили: вернемся к рассылке позже
+			return
+		}
+	}
+}
+
+// sendMailing отправляет рассылку, пока у нее есть получатели; true - рассылка завершена
+func (s *Service) sendMailing(ctx context.Context, m model.Mailing) (bool, error) {
+	err := s.repo.StartMailing(ctx, &m)
+	if errors.Is(err, errs.ErrMailingNotFound) {
+		// Отменили, пока брали в аренду
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error repo.StartMailing: %w", err)
+	}
+	s.showMailingProgress(ctx, &m)
+
+	// Результат уже отправленного сообщения записываем и при остановке бота, иначе оно уйдет повторно
+	saveCtx := context.WithoutCancel(ctx)
+
+	for {
+		ids, err := s.repo.ClaimRecipients(ctx, m.ID, mailingBatchSize, mailingLease)
+		if err != nil {
+			return false, fmt.Errorf("error repo.ClaimRecipients: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		done, err := s.sendMailingBatch(ctx, &m, ids)
+		if done < len(ids) {
+			// Необработанных получателей сразу возвращаем в очередь, не дожидаясь истечения заявки
+			if err := s.repo.ReleaseRecipients(saveCtx, m.ID, ids[done:]); err != nil {
+				log.Println("error repo.ReleaseRecipients:", err)
+			}
+		}
+		if err != nil || ctx.Err() != nil {
+			return false, err
+		}
+
+		s.showMailingProgress(ctx, &m)
+
+		ok, err := s.repo.ExtendMailingLease(ctx, m.ID, s.workerID, mailingLease)
+		if err != nil {
+			return false, fmt.Errorf("error repo.ExtendMailingLease: %w", err)
+		}
+		if !ok {
+			log.Printf("mailing %d: lease lost, another replica continues", m.ID)
+			return false, nil
+		}
+	}
+
+	finished, err := s.repo.FinishMailing(ctx, m.ID)
+	if err != nil {
+		return false, fmt.Errorf("error repo.FinishMailing: %w", err)
+	}
+	if !finished {
+		return false, nil
+	}
+	m.Status = model.MailingDone
+	s.showMailingProgress(ctx, &m)
+	return true, nil
+}
+
+// sendMailingBatch отправляет рассылку пачке получателей и возвращает, скольких из них обработал
+func (s *Service) sendMailingBatch(ctx context.Context, m *model.Mailing, ids []int64) (int, error) {
+	saveCtx := context.WithoutCancel(ctx)
+
+	for i, id := range ids {
+		if ctx.Err() != nil {
+			return i, nil
+		}
+
+		status, errText := model.DeliverySent, ""
+		err := s.sendRespectingLimits(ctx, mailingMessage(id, *m))
+		if ctx.Err() != nil {
+			// Остановились посреди ожидания 429: получатель остается в очереди
+			return i, nil
+		}
+		if err != nil {
+			status, errText = model.DeliveryFailed, err.Error()
+			log.Printf("mailing %d: failed to send to %d: %v", m.ID, id, err)
+
+			if isBlockedByUser(err) {
+				if err := s.repo.MarkUserBlocked(saveCtx, id); err != nil {
+					log.Println("error repo.MarkUserBlocked:", err)
+				}
+			}
+		}
+		if err := s.repo.SetDeliveryStatus(saveCtx, m.ID, id, status, errText); err != nil {
+			return i, fmt.Errorf("error repo.SetDeliveryStatus: %w", err)
+		}
+		if status == model.DeliverySent {
+			m.Sent++
+		} else {
+			m.Failed++
+		}
+
+		select {
+		case <-ctx.Done():
+			return i + 1, nil
+		case <-time.After(s.rateLimit):
+		}
+	}
+
+	return len(ids), nil
+}
+
+// sendRespectingLimits отправляет сообщение; на 429 ждет ровно retry_after из ответа Telegram
+// и повторяет отправку тому же получателю
+func (s *Service) sendRespectingLimits(ctx context.Context, msg tgbotapi.Chattable) error {
+	for {
+		_, err := s.bot.Send(msg)
+
+		var tgErr *tgbotapi.Error
+		if !errors.As(err, &tgErr) || tgErr.Code != http.StatusTooManyRequests || tgErr.RetryAfter <= 0 {
+			return err
+		}
+
+		wait := time.Duration(tgErr.RetryAfter) * time.Second
+		log.Printf("telegram flood limit, retry after %s", wait)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// isBlockedByUser - Telegram больше не даст писать пользователю: он заблокировал бота или удалил аккаунт
+func isBlockedByUser(err error) bool {
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) || tgErr.Code != http.StatusForbidden {
+		return false
+	}
+
+	msg := strings.ToLower(tgErr.Message)
+	return strings.Contains(msg, "bot was blocked by the user") || strings.Contains(msg, "user is deactivated")
+}
+
+// showMailingProgress обновляет сообщение с прогрессом в чате админа, а при первом запуске отправляет его
+func (s *Service) showMailingProgress(ctx context.Context, m *model.Mailing) {
+	text := mailingProgressText(*m)
+
+	if m.MessageID != 0 {
+		_, err := s.bot.Request(tgbotapi.NewEditMessageText(m.ChatID, m.MessageID, text))
+		if err != nil && !strings.Contains(err.Error(), "message is not modified") {
+			log.Printf("error edit mailing %d progress: %v", m.ID, err)
+		}
+		return
+	}
+
+	sent, err := s.bot.Send(tgbotapi.NewMessage(m.ChatID, text))
+	if err != nil {
+		log.Printf("error send mailing %d progress: %v", m.ID, err)
+		return
+	}
+	m.MessageID = sent.MessageID
+	if err := s.repo.SetMailingMessage(ctx, m.ID, m.MessageID); err != nil {
+		log.Println("error repo.SetMailingMessage:", err)
+	}
+}
+
+func mailingProgressText(m model.Mailing) string {
+	done := m.Sent + m.Failed
+
+	var b strings.Builder
+	if m.Status == model.MailingDone {
+		fmt.Fprintf(&b, "✅ Рассылка #%d завершена: отправлено %d/%d", m.ID, m.Sent, m.Total)
+	} else {
+		fmt.Fprintf(&b, "📣 Рассылка #%d: отправлено %d/%d", m.ID, done, m.Total)
+	}
+	if m.Failed > 0 {
+		fmt.Fprintf(&b, "\nНе доставлено: %d", m.Failed)
+	}
+	return b.String()
+}
+
+// mailingMessage собирает сообщение рассылки для получателя с учетом вложения
+func mailingMessage(chatID int64, m model.Mailing) tgbotapi.Chattable {
+	switch m.MediaType {
+	case "photo":
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileID(m.MediaID))
+		photo.Caption = m.Text
+		return photo
+	case "video":
+		video := tgbotapi.NewVideo(chatID, tgbotapi.FileID(m.MediaID))
+		video.Caption = m.Text
+		return video
+	case "audio":
+		audio := tgbotapi.NewAudio(chatID, tgbotapi.FileID(m.MediaID))
+		audio.Caption = m.Text
+		return audio
+	case "voice":
+		return tgbotapi.NewVoice(chatID, tgbotapi.FileID(m.MediaID))
+	default:
+		return tgbotapi.NewMessage(chatID, m.Text)
+	}
+}
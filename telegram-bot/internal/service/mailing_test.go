@@ -0,0 +1,35 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestIsBlockedByUser(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "blocked", err: &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, want: true},
+		{name: "deactivated", err: &tgbotapi.Error{Code: 403, Message: "Forbidden: user is deactivated"}, want: true},
+		{name: "different case", err: &tgbotapi.Error{Code: 403, Message: "Forbidden: Bot Was Blocked By The User"}, want: true},
+		{name: "wrapped", err: fmt.Errorf("send: %w", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}), want: true},
+		{name: "other forbidden", err: &tgbotapi.Error{Code: 403, Message: "Forbidden: bot is not a member of the channel chat"}, want: false},
+		{name: "flood limit", err: &tgbotapi.Error{Code: 429, Message: "Too Many Requests: retry after 5"}, want: false},
+		{name: "blocked text with other code", err: &tgbotapi.Error{Code: 400, Message: "bot was blocked by the user"}, want: false},
+		{name: "not a telegram error", err: errors.New("Forbidden: bot was blocked by the user"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBlockedByUser(tt.err); got != tt.want {
+				t.Fatalf("isBlockedByUser(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
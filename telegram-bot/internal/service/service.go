@@ -4,30 +4,59 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"os"
+	"strings"
 	"tgbot-bad-da-yo/internal/repo"
 	"tgbot-bad-da-yo/internal/repo/errs"
 	"tgbot-bad-da-yo/model"
 	"time"
 
+	"github.com/berduk-dev/promocode"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/jackc/pgx/v5"
 )
 
 type Service struct {
 	repo      repo.Repository
 	bot       *tgbotapi.BotAPI
+	codes     promocode.Generator
+	redeemTTL time.Duration
 	rateLimit time.Duration
+
+	// Сигнал фоновой отправке рассылок, что появилась новая
+	mailingWake chan struct{}
+	// Имя этой реплики бота в аренде рассылок
+	workerID string
 }
 
-func New(repo repo.Repository, bot *tgbotapi.BotAPI) Service {
+func New(repo repo.Repository, bot *tgbotapi.BotAPI, codes promocode.Generator, redeemTTL time.Duration) Service {
 	return Service{
 		repo:      repo,
 		bot:       bot,
+		codes:     codes,
+		redeemTTL: redeemTTL,
 		rateLimit: 50 * time.Millisecond,
+
+		mailingWake: make(chan struct{}, 1),
+		workerID:    newWorkerID(),
 	}
 }
 
+// newWorkerID - уникальное имя процесса: хост, pid и время запуска
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "bot"
+	}
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
 func (s *Service) CreateUser(ctx context.Context, userID int64) error {
 	err := s.repo.CreateUser(ctx, userID)
+	if errors.Is(err, errs.ErrUserAlreadyExists) {
+		return err
+	}
 	if err != nil {
 		return fmt.Errorf("error repo.CreateUser: %w", err)
 	}
@@ -35,6 +64,16 @@ func (s *Service) CreateUser(ctx context.Context, userID int64) error {
 	return nil
 }
 
+// UnblockUser снимает отметку о блокировке бота: пользователь снова пишет боту и получает рассылки
+func (s *Service) UnblockUser(ctx context.Context, userID int64) error {
+	err := s.repo.UnblockUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error repo.UnblockUser: %w", err)
+	}
+
+	return nil
+}
+
 func (s *Service) GetPrizeByUserID(ctx context.Context, userID int64) (*model.Prize, error) {
 	prize, err := s.repo.GetPrizeByUserID(ctx, userID)
 	if err != nil {
@@ -43,7 +82,14 @@ func (s *Service) GetPrizeByUserID(ctx context.Context, userID int64) (*model.Pr
 	return prize, nil
 }
 
+// GetPrizeByCode ищет приз по коду. Коды текущего формата с неверным
+// контрольным символом отсекаются без запроса в базу.
 func (s *Service) GetPrizeByCode(ctx context.Context, code string) (model.Prize, error) {
+	code = promocode.Normalize(code)
+	if len(code) == s.codes.Len() && !s.codes.Valid(code) {
+		return model.Prize{}, errs.ErrCodeMistyped
+	}
+
 	prize, err := s.repo.GetPrizeByCode(ctx, code)
 	if err != nil {
 		return model.Prize{}, fmt.Errorf("error repo.GetPrizeByCode: %w", err)
@@ -51,69 +97,126 @@ func (s *Service) GetPrizeByCode(ctx context.Context, code string) (model.Prize,
 	return prize, nil
 }
 
-func (s *Service) ActivateCode(ctx context.Context, code string) error {
-	err := s.repo.ActivateCode(ctx, code)
+// ActivateCode погашает код, если он не просрочен, не аннулирован, действует в магазине кассира
+// и сейчас открыто окно погашения его акции.
+// Каждая попытка, в том числе отклоненная, попадает в журнал redemptions от имени кассира
+func (s *Service) ActivateCode(ctx context.Context, code string, actor model.RedemptionActor) error {
+	code = promocode.Normalize(code)
+
+	prize, err := s.repo.GetPrizeByCode(ctx, code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		s.recordRedemption(ctx, nil, code, actor, model.RedemptionNotFound)
+		return errs.ErrPrizeNotFound
+	}
 	if err != nil {
+		return fmt.Errorf("error repo.GetPrizeByCode: %w", err)
+	}
+
+	switch {
+	case prize.UsedAt != nil:
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionAlreadyActivated)
+		return errs.ErrAlreadyActivated
+	case prize.Expired(time.Now()):
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionExpired)
+		return errs.ErrPrizeExpired
+	case prize.VoidedAt != nil:
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionVoided)
+		return errs.ErrPrizeVoided
+	case !prize.ValidAt(actor.StoreID):
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionWrongStore)
+		return errs.ErrWrongStore
+	case !prize.Campaign.CanRedeemAt(time.Now()):
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionOutsideWindow)
+		return errs.ErrOutsideRedeemWindow
+	}
+
+	// Между проверкой и погашением другой кассир мог активировать код,
+	// а фоновая задача или админ - аннулировать его
+	err = s.repo.ActivateCode(ctx, prize.Code, actor)
+	switch {
+	case errors.Is(err, errs.ErrAlreadyActivated):
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionAlreadyActivated)
+		return errs.ErrAlreadyActivated
+	case errors.Is(err, errs.ErrPrizeExpired):
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionExpired)
+		return errs.ErrPrizeExpired
+	case errors.Is(err, errs.ErrPrizeVoided):
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionVoided)
+		return errs.ErrPrizeVoided
+	case err != nil:
+		s.recordRedemption(ctx, &prize.ID, prize.Code, actor, model.RedemptionFailed)
 		return fmt.Errorf("error repo.ActivateCode: %w", err)
 	}
 
 	return nil
 }
 
-func (s *Service) GetTelegramIDs(ctx context.Context) ([]int64, error) {
-	telegramIDs, err := s.repo.GetTelegramIDs(ctx)
+// CheckUndoStore проверяет, что активацию кода отменяют в том магазине, где его погасили
+func (s *Service) CheckUndoStore(ctx context.Context, code string, storeID int64) error {
+	activatedIn, err := s.repo.GetActivationStoreID(ctx, promocode.Normalize(code))
+	if errors.Is(err, errs.ErrPrizeNotFound) {
+		return errs.ErrPrizeNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error repo.GetTelegramIDs: %w", err)
+		return fmt.Errorf("error repo.GetActivationStoreID: %w", err)
 	}
-
-	return telegramIDs, nil
+	if activatedIn != 0 && activatedIn != storeID {
+		return errs.ErrWrongStore
+	}
+	return nil
 }
 
-func (s *Service) Broadcast(ctx context.Context, text, mediaID, mediaType string) error {
-	ids, err := s.repo.GetTelegramIDs(ctx)
+// UndoActivation отменяет ошибочную активацию кода в магазине, где его погасили.
+// Причина обязательна и сохраняется в журнале вместе с магазином
+func (s *Service) UndoActivation(ctx context.Context, code string, actor model.RedemptionActor, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return errs.ErrReasonRequired
+	}
+
+	err := s.repo.UndoActivation(ctx, promocode.Normalize(code), actor, reason)
 	if err != nil {
-		return fmt.Errorf("failed to load telegram ids: %w", err)
-	}
-
-	for _, id := range ids {
-		var msg tgbotapi.Chattable
-
-		switch mediaType {
-		case "photo":
-			photo := tgbotapi.NewPhoto(id, tgbotapi.FileID(mediaID))
-			photo.Caption = text
-			msg = photo
-		case "video":
-			video := tgbotapi.NewVideo(id, tgbotapi.FileID(mediaID))
-			video.Caption = text
-			msg = video
-		case "audio":
-			audio := tgbotapi.NewAudio(id, tgbotapi.FileID(mediaID))
-			audio.Caption = text
-			msg = audio
-		case "voice":
-			voice := tgbotapi.NewVoice(id, tgbotapi.FileID(mediaID))
-			msg = voice
-		default:
-			msg = tgbotapi.NewMessage(id, text)
-		}
-
-		if _, err := s.bot.Send(msg); err != nil {
-			fmt.Printf("failed to send message to %d: %v\n", id, err)
-		}
-
-		time.Sleep(s.rateLimit)
+		return fmt.Errorf("error repo.UndoActivation: %w", err)
 	}
 
 	return nil
 }
 
+// Ошибка записи в журнал не должна мешать кассиру, поэтому только логируем ее
+func (s *Service) recordRedemption(ctx context.Context, prizeID *int64, code string, actor model.RedemptionActor, result string) {
+	if err := s.repo.AddRedemption(ctx, prizeID, code, actor, result); err != nil {
+		log.Printf("error repo.AddRedemption for code '%s': %v", code, err)
+	}
+}
+
+// GetRedemptions возвращает историю попыток погашения кода
+func (s *Service) GetRedemptions(ctx context.Context, code string) ([]model.Redemption, error) {
+	redemptions, err := s.repo.GetRedemptions(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.GetRedemptions: %w", err)
+	}
+
+	return redemptions, nil
+}
+
+func (s *Service) GetTelegramIDs(ctx context.Context) ([]int64, error) {
+	telegramIDs, err := s.repo.GetTelegramIDs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.GetTelegramIDs: %w", err)
+	}
+
+	return telegramIDs, nil
+}
+
 func (s *Service) AddTelegramIdIntoPrize(ctx context.Context, telegramID int64, code string) error {
-	err := s.repo.AddTelegramIdIntoPrize(ctx, telegramID, code)
+	err := s.repo.AddTelegramIdIntoPrize(ctx, telegramID, code, s.redeemTTL)
 	switch {
 	case errors.Is(err, errs.ErrTelegramIDAlreadySet):
 		return fmt.Errorf("юзер уже получил этот приз")
 
+	case errors.Is(err, errs.ErrPrizeExpired):
+		return fmt.Errorf("срок действия кода истек: %w", err)
+
 	case errors.Is(err, errs.ErrPrizeNotFound):
 		return fmt.Errorf("приз с таким кодом не найден")
 
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"tgbot-bad-da-yo/internal/repo/errs"
+	"tgbot-bad-da-yo/model"
+)
+
+// StaffRole возвращает роль пользователя; пустая роль - не сотрудник
+func (s *Service) StaffRole(ctx context.Context, telegramID int64) (model.Role, error) {
+	role, err := s.repo.GetStaffRole(ctx, telegramID)
+	if err != nil {
+		return "", fmt.Errorf("error repo.GetStaffRole: %w", err)
+	}
+
+	return role, nil
+}
+
+// Can проверяет право пользователя на действие. Через него проходят все команды и кнопки сотрудников
+func (s *Service) Can(ctx context.Context, telegramID int64, perm model.Permission) (bool, error) {
+	role, err := s.StaffRole(ctx, telegramID)
+	if err != nil {
+		return false, err
+	}
+
+	return role.Can(perm), nil
+}
+
+// BindStaff привязывает сотрудника, добавленного по @username, к его telegram_id.
+// Вызывается только на /start: username в Telegram можно освободить и занять заново,
+// поэтому роль не выдается молча при любом обращении к боту
+func (s *Service) BindStaff(ctx context.Context, telegramID int64, username string) error {
+	if username == "" {
+		return nil
+	}
+
+	err := s.repo.BindStaffMember(ctx, telegramID, strings.ToLower(username))
+	if err != nil {
+		return fmt.Errorf("error repo.BindStaffMember: %w", err)
+	}
+
+	return nil
+}
+
+// AddStaff выдает роль сотруднику. Менять можно только роли ниже своей и не себе
+func (s *Service) AddStaff(ctx context.Context, actor model.StaffMember, target model.StaffMember) error {
+	if !actor.Role.CanManage(target.Role) || isSameStaff(actor, target) {
+		return errs.ErrForbidden
+	}
+
+	existing, err := s.repo.GetStaffMember(ctx, target)
+	if err != nil && !errors.Is(err, errs.ErrStaffNotFound) {
+		return fmt.Errorf("error repo.GetStaffMember: %w", err)
+	}
+	if err == nil && (!actor.Role.CanManage(existing.Role) || isSameStaff(actor, existing)) {
+		return errs.ErrForbidden
+	}
+
+	err = s.repo.SaveStaffMember(ctx, target, *actor.TelegramID)
+	if err != nil {
+		return fmt.Errorf("error repo.SaveStaffMember: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveStaff отбирает роль у сотрудника
+func (s *Service) RemoveStaff(ctx context.Context, actor model.StaffMember, target model.StaffMember) error {
+	existing, err := s.repo.GetStaffMember(ctx, target)
+	if err != nil {
+		return fmt.Errorf("error repo.GetStaffMember: %w", err)
+	}
+	if !actor.Role.CanManage(existing.Role) || isSameStaff(actor, existing) {
+		return errs.ErrForbidden
+	}
+
+	err = s.repo.RemoveStaffMember(ctx, target)
+	if err != nil {
+		return fmt.Errorf("error repo.RemoveStaffMember: %w", err)
+	}
+
+	return nil
+}
+
+// ListStaff возвращает всех сотрудников
+func (s *Service) ListStaff(ctx context.Context) ([]model.StaffMember, error) {
+	members, err := s.repo.ListStaff(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.ListStaff: %w", err)
+	}
+
+	return members, nil
+}
+
+// EnsureStaff добавляет сотрудника из настроек бота, не трогая уже выданную роль
+func (s *Service) EnsureStaff(ctx context.Context, telegramID int64, role model.Role) error {
+	err := s.repo.EnsureStaffMember(ctx, telegramID, role)
+	if err != nil {
+		return fmt.Errorf("error repo.EnsureStaffMember: %w", err)
+	}
+
+	return nil
+}
+
+func isSameStaff(a, b model.StaffMember) bool {
+	if a.TelegramID != nil && b.TelegramID != nil && *a.TelegramID == *b.TelegramID {
+		return true
+	}
+	return a.Username != nil && b.Username != nil && *a.Username == *b.Username
+}
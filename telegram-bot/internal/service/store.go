@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"tgbot-bad-da-yo/model"
+	"time"
+)
+
+// Загружает часовой пояс магазина; при ошибке в настройке показываем время по UTC
+func withLocation(store model.Store) model.Store {
+	location, err := time.LoadLocation(store.Timezone)
+	if err != nil {
+		log.Printf("store %d has invalid timezone '%s': %v", store.ID, store.Timezone, err)
+		location = time.UTC
+	}
+	store.Location = location
+	return store
+}
+
+// GetStoreByChatID находит магазин, к которому привязан чат кассиров
+func (s *Service) GetStoreByChatID(ctx context.Context, chatID int64) (model.Store, error) {
+	store, err := s.repo.GetStoreByChatID(ctx, chatID)
+	if err != nil {
+		return model.Store{}, fmt.Errorf("error repo.GetStoreByChatID: %w", err)
+	}
+
+	return withLocation(store), nil
+}
+
+// GetPrizeStores возвращает магазины, в которых можно получить приз
+func (s *Service) GetPrizeStores(ctx context.Context, prize model.Prize) ([]model.Store, error) {
+	stores, err := s.repo.GetStores(ctx, prize.StoreIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error repo.GetStores: %w", err)
+	}
+
+	for i := range stores {
+		stores[i] = withLocation(stores[i])
+	}
+	return stores, nil
+}
+
+// BindLegacyCashierChat переносит чат кассиров из настроек бота в первый магазин
+func (s *Service) BindLegacyCashierChat(ctx context.Context, chatID int64) (bool, error) {
+	bound, err := s.repo.BindLegacyCashierChat(ctx, chatID)
+	if err != nil {
+		return false, fmt.Errorf("error repo.BindLegacyCashierChat: %w", err)
+	}
+
+	return bound, nil
+}
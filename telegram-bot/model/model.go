@@ -1,13 +1,56 @@
 package model
 
-import "time"
+import (
+	"slices"
+	"strings"
+	"time"
+)
 
 type Prize struct {
-	ID        int64      `json:"id"`
-	Code      string     `json:"code"`
-	Prize     string     `json:"prize"`
-	CreatedAt *time.Time `json:"created_at"`
-	UsedAt    *time.Time `json:"used_at"`
+	ID         int64      `json:"id"`
+	Code       string     `json:"code"`
+	Prize      string     `json:"prize"`
+	CreatedAt  *time.Time `json:"created_at"`
+	UsedAt     *time.Time `json:"used_at"`
+	VoidedAt   *time.Time `json:"voided_at"`
+	VoidReason *string    `json:"void_reason"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	Campaign   Campaign   `json:"campaign"`
+	// Магазины, где можно получить приз; пусто - в любом
+	StoreIDs []int64 `json:"store_ids"`
+}
+
+// Причина аннулирования просроченного кода (ставит фоновая задача API)
+const VoidReasonExpired = "expired"
+
+// Expired проверяет, истек ли срок непогашенного кода к моменту t
+func (p Prize) Expired(t time.Time) bool {
+	if p.UsedAt != nil {
+		return false
+	}
+	if p.VoidReason != nil && *p.VoidReason == VoidReasonExpired {
+		return true
+	}
+	return p.ExpiresAt != nil && !t.Before(*p.ExpiresAt)
+}
+
+// ValidAt проверяет, можно ли получить приз в магазине
+func (p Prize) ValidAt(storeID int64) bool {
+	return len(p.StoreIDs) == 0 || slices.Contains(p.StoreIDs, storeID)
+}
+
+// Campaign - акция, к которой относится код, с окном погашения и адресом
+type Campaign struct {
+	ID             int64     `json:"id"`
+	Name           string    `json:"name"`
+	RedeemStartsAt time.Time `json:"redeem_starts_at"`
+	RedeemEndsAt   time.Time `json:"redeem_ends_at"`
+	Address        string    `json:"address"`
+}
+
+// CanRedeemAt проверяет, попадает ли момент в окно погашения акции
+func (c Campaign) CanRedeemAt(t time.Time) bool {
+	return !t.Before(c.RedeemStartsAt) && t.Before(c.RedeemEndsAt)
 }
 
 type User struct {
@@ -15,3 +58,204 @@ type User struct {
 	Phone      *string
 	CreatedAt  time.Time
 }
+
+// Результаты попытки погашения кода в журнале redemptions
+const (
+	RedemptionActivated     = "activated"
+	RedemptionExpired       = "expired"
+	RedemptionVoided        = "voided"
+	RedemptionOutsideWindow = "outside_window"
+	RedemptionNotFound      = "not_found"
+	RedemptionFailed        = "failed"
+
+	RedemptionAlreadyActivated = "already_activated"
+	RedemptionUndone           = "undone"
+	RedemptionWrongStore       = "wrong_store"
+)
+
+// RedemptionActor - кассир, нажавший кнопку активации, сообщение, в котором он это сделал, и магазин этого чата
+type RedemptionActor struct {
+	TelegramID int64
+	Username   string
+	ChatID     int64
+	MessageID  int
+	StoreID    int64
+}
+
+// Redemption - запись журнала попыток погашения
+type Redemption struct {
+	ID        int64
+	PrizeID   *int64
+	Code      string
+	Actor     RedemptionActor
+	Result    string
+	Reason    string
+	StoreName string
+	CreatedAt time.Time
+}
+
+// Store - магазин со своим чатом кассиров и часовым поясом
+type Store struct {
+	ID            int64
+	Name          string
+	Address       string
+	Hours         string
+	Timezone      string
+	CashierChatID *int64
+	// Location - загруженный Timezone, в нем показываем время в чате кассиров
+	Location *time.Location
+}
+
+// Role - роль сотрудника в боте
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleAdmin     Role = "admin"
+	RoleCashier   Role = "cashier"
+	RoleDeveloper Role = "developer"
+)
+
+// Permission - действие в боте, доступное только сотрудникам
+type Permission string
+
+const (
+	PermViewUsers   Permission = "view_users"
+	PermBroadcast   Permission = "broadcast"
+	PermRedeem      Permission = "redeem"
+	PermUndoRedeem  Permission = "undo_redeem"
+	PermManageStaff Permission = "manage_staff"
+)
+
+// Права ролей; единственное место, где решается, кому что можно
+var rolePermissions = map[Role][]Permission{
+	RoleOwner:     {PermViewUsers, PermBroadcast, PermRedeem, PermUndoRedeem, PermManageStaff},
+	RoleAdmin:     {PermViewUsers, PermBroadcast, PermRedeem, PermUndoRedeem, PermManageStaff},
+	RoleDeveloper: {PermViewUsers, PermBroadcast, PermRedeem, PermUndoRedeem},
+	RoleCashier:   {PermRedeem},
+}
+
+// ParseRole проверяет название роли из команды
+func ParseRole(s string) (Role, bool) {
+	role := Role(strings.ToLower(s))
+	_, ok := rolePermissions[role]
+	return role, ok
+}
+
+// Can проверяет, есть ли у роли право. Пустая роль - не сотрудник
+func (r Role) Can(perm Permission) bool {
+	return slices.Contains(rolePermissions[r], perm)
+}
+
+// CanManage проверяет, может ли роль выдать или отобрать другую роль:
+// владелец управляет всеми, администратор - только кассирами
+func (r Role) CanManage(other Role) bool {
+	switch r {
+	case RoleOwner:
+		return true
+	case RoleAdmin:
+		return other == RoleCashier
+	default:
+		return false
+	}
+}
+
+// StaffMember - сотрудник; до первого сообщения боту может быть известен только по username
+type StaffMember struct {
+	TelegramID *int64
+	Username   *string
+	Role       Role
+	CreatedAt  time.Time
+}
+
+// Шаги диалогов, состояние которых хранится в базе
+const (
+	StepClaimPhone   = "claim_phone"
+	StepMailCompose  = "mail_compose"
+	StepMailSegment  = "mail_segment"
+	StepMailDates    = "mail_dates"
+	StepMailConfirm  = "mail_confirm"
+	StepMailSchedule = "mail_schedule"
+	StepUndoReason   = "undo_reason"
+)
+
+// Conversation - текущий шаг диалога пользователя в чате и его данные
+type Conversation struct {
+	UserID int64  `json:"-"`
+	ChatID int64  `json:"-"`
+	Step   string `json:"-"`
+
+	// Код приза, ожидающий номер телефона, или код, активацию которого отменяют
+	Code string `json:"code,omitempty"`
+
+	// Черновик рассылки
+	MailText    string `json:"mail_text,omitempty"`
+	MailMediaID string `json:"mail_media_id,omitempty"`
+	MailMedia   string `json:"mail_media,omitempty"`
+	// Аудитория рассылки, выбранная после черновика
+	MailSegment *Segment `json:"mail_segment,omitempty"`
+}
+
+// Статусы рассылки
+const (
+	MailingPending   = "pending"
+	MailingRunning   = "running"
+	MailingDone      = "done"
+	MailingCancelled = "cancelled"
+)
+
+// Статусы доставки рассылки одному получателю
+const (
+	DeliveryPending = "pending"
+	DeliverySent    = "sent"
+	DeliveryFailed  = "failed"
+)
+
+// Mailing - рассылка, которую бот отправляет в фоне
+type Mailing struct {
+	ID        int64
+	Text      string
+	MediaID   string
+	MediaType string
+	Status    string
+	CreatedBy int64
+
+	// Чат и сообщение с прогрессом; MessageID 0 - сообщение еще не отправлено
+	ChatID    int64
+	MessageID int
+
+	Segment Segment
+	// Когда начать отправку; nil - сразу
+	ScheduledAt *time.Time
+
+	Total  int
+	Sent   int
+	Failed int
+
+	CreatedAt time.Time
+}
+
+// Аудитории рассылок
+const (
+	SegmentAll        = "all"
+	SegmentUnredeemed = "unredeemed"
+	SegmentRedeemed   = "redeemed"
+	SegmentNoPhone    = "no_phone"
+	SegmentRegistered = "registered"
+	SegmentCampaign   = "campaign"
+	SegmentPrize      = "prize"
+)
+
+// Segment - аудитория рассылки. ID - акция или приз каталога, From и To - период регистрации [From, To)
+type Segment struct {
+	Kind string     `json:"kind"`
+	ID   int64      `json:"id,omitempty"`
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+// SegmentOption - акция или приз каталога, которые можно выбрать аудиторией рассылки
+type SegmentOption struct {
+	ID   int64
+	Name string
+}